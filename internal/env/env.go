@@ -0,0 +1,142 @@
+// Package env loads configuration from environment variables, shared by vk and vlog so that both read the
+// environment in the same way
+package env
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load sets each field of the struct that dst points to from the environment variable named by the field's env
+// tag, with prefix prepended, recursing into nested structs. Only variables that are present are applied, so a
+// variable set to an empty string resets its field to the zero value (or an empty list), and pointer fields are only
+// allocated for variables that are present. An error is returned for each variable that can't be parsed, and the
+// fields of those variables are left unchanged
+func Load(prefix string, dst interface{}) []error {
+	return load(prefix, reflect.ValueOf(dst).Elem())
+}
+
+func load(prefix string, v reflect.Value) []error {
+	errs := []error{}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		structField := v.Type().Field(i)
+
+		if !structField.IsExported() {
+			continue
+		}
+
+		key := structField.Tag.Get("env")
+
+		if key == "" {
+			if field.Kind() == reflect.Struct {
+				errs = append(errs, load(prefix, field)...)
+			}
+
+			continue
+		}
+
+		value, present := os.LookupEnv(prefix + key)
+		if !present {
+			continue
+		}
+
+		if err := set(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", prefix, key, err))
+		}
+	}
+
+	return errs
+}
+
+// set parses value into field
+func set(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Pointer {
+		elem := reflect.New(field.Type().Elem())
+		if err := set(elem.Elem(), value); err != nil {
+			return err
+		}
+
+		field.Set(elem)
+
+		return nil
+	}
+
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		if field.Kind() == reflect.Slice {
+			field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+		} else {
+			field.Set(reflect.Zero(field.Type()))
+		}
+
+		return nil
+	}
+
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(value, ",")
+		slice := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+
+		for i, part := range parts {
+			if err := set(slice.Index(i), part); err != nil {
+				return err
+			}
+		}
+
+		field.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
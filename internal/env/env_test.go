@@ -0,0 +1,66 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+type nested struct {
+	Limit int `env:"LIMIT"`
+}
+
+type config struct {
+	Name     string        `env:"NAME"`
+	Port     int           `env:"PORT"`
+	Timeout  time.Duration `env:"TIMEOUT"`
+	Enabled  *bool         `env:"ENABLED"`
+	Disabled *bool         `env:"DISABLED"`
+	Routes   []string      `env:"ROUTES"`
+	Origins  []string      `env:"ORIGINS"`
+	Nested   nested
+	untagged string
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("TEST_NAME", "loaded")
+	t.Setenv("TEST_TIMEOUT", "5s")
+	t.Setenv("TEST_ENABLED", "false")
+	t.Setenv("TEST_ROUTES", "/health, /ready")
+	t.Setenv("TEST_ORIGINS", "")
+	t.Setenv("TEST_LIMIT", "10")
+
+	c := &config{Port: 8080, Origins: []string{"*"}}
+
+	if errs := Load("TEST_", c); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if c.Name != "loaded" || c.Port != 8080 || c.Timeout != 5*time.Second || c.Nested.Limit != 10 {
+		t.Errorf("unexpected values %+v", c)
+	}
+
+	// a present variable turns a switch off, and an empty one clears a list
+	if c.Enabled == nil || *c.Enabled || c.Disabled != nil {
+		t.Errorf("unexpected switches %v, %v", c.Enabled, c.Disabled)
+	}
+
+	if len(c.Routes) != 2 || c.Routes[1] != "/ready" || c.Origins == nil || len(c.Origins) != 0 {
+		t.Errorf("unexpected lists %q, %q", c.Routes, c.Origins)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv("TEST_PORT", "eighty")
+	t.Setenv("TEST_ENABLED", "sometimes")
+	t.Setenv("TEST_NAME", "still loaded")
+
+	c := &config{Port: 8080}
+
+	if errs := Load("TEST_", c); len(errs) != 2 {
+		t.Errorf("expected 2 errors, got %v", errs)
+	}
+
+	if c.Port != 8080 || c.Enabled != nil || c.Name != "still loaded" {
+		t.Errorf("unexpected values %+v", c)
+	}
+}
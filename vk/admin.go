@@ -0,0 +1,316 @@
+package vk
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// AdminEndpoint is an operational endpoint served by the admin server
+type AdminEndpoint string
+
+// AdminHealth and others are the endpoints available on the admin server
+const (
+	AdminHealth   AdminEndpoint = "health"   // GET /health responds 200 while the server is running
+	AdminMetrics  AdminEndpoint = "metrics"  // GET /metrics serves runtime and server metrics in the Prometheus text format
+	AdminRoutes   AdminEndpoint = "routes"   // GET /routes lists the routes handled by the server
+	AdminLogLevel AdminEndpoint = "loglevel" // GET /loglevel returns the log levels, PUT /loglevel?level=debug changes one
+	AdminReload   AdminEndpoint = "reload"   // POST /reload reloads the server's config, see Server.Reload
+	AdminPprof    AdminEndpoint = "pprof"    // /debug/pprof/ serves the net/http/pprof profiles
+)
+
+// defaultAdminBindAddress keeps the admin server off the public interfaces unless UseAdminBindAddress is used
+const defaultAdminBindAddress = "127.0.0.1"
+
+// defaultAdminEndpoints are served if UseAdminEndpoints is not used. pprof is excluded as profiling is costly
+var defaultAdminEndpoints = []AdminEndpoint{AdminHealth, AdminMetrics, AdminRoutes, AdminLogLevel, AdminReload}
+
+var allAdminEndpoints = append(append([]AdminEndpoint{}, defaultAdminEndpoints...), AdminPprof)
+
+// RouteInfo describes a route handled by a Router
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// adminEndpointFromString validates the name of an admin endpoint
+func adminEndpointFromString(name string) (AdminEndpoint, error) {
+	for _, e := range allAdminEndpoints {
+		if string(e) == strings.ToLower(name) {
+			return e, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid admin endpoint %q", name)
+}
+
+// newAdminRouter creates the admin server's router, with the configured endpoints mounted
+func (s *Server) newAdminRouter() *Router {
+	router := NewRouter(s.options.Logger, "")
+	router.WithMiddlewares(ErrorMiddleware())
+
+	endpoints := s.options.AdminEndpoints
+	if endpoints == nil {
+		endpoints = defaultAdminEndpoints
+	}
+
+	for _, endpoint := range endpoints {
+		switch endpoint {
+		case AdminHealth:
+			router.GET("/health", s.handleAdminHealth)
+		case AdminMetrics:
+			router.GET("/metrics", s.handleAdminMetrics)
+		case AdminRoutes:
+			router.GET("/routes", s.handleAdminRoutes)
+		case AdminLogLevel:
+			router.GET("/loglevel", s.handleAdminLogLevel)
+			router.PUT("/loglevel", s.handleAdminLogLevel)
+			router.DELETE("/loglevel", s.handleAdminLogLevel)
+		case AdminReload:
+			router.POST("/reload", s.ReloadHandler())
+		case AdminPprof:
+			router.HandleHTTP(http.MethodGet, "/debug/pprof/*profile", handlePprof)
+			router.HandleHTTP(http.MethodPost, "/debug/pprof/*profile", handlePprof)
+		}
+	}
+
+	return router
+}
+
+// AdminRouter returns the admin server's Router, to which additional operational routes can be added before the
+// server is started. It returns nil if the server was not configured with UseAdminServer
+func (s *Server) AdminRouter() *Router {
+	return s.adminRouter
+}
+
+// AdminAddr returns the address of the admin server, or nil if it isn't configured or the server hasn't been started
+func (s *Server) AdminAddr() net.Addr {
+	// the listener is bound once the addresses are set
+	if s.adminListener == nil || len(s.Addrs()) == 0 {
+		return nil
+	}
+
+	return s.adminListener.listener.Addr()
+}
+
+// Routes returns the method and path of every route the server handles. It is empty until the server is started
+func (s *Server) Routes() []RouteInfo {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]RouteInfo{}, s.internalRouter.routes...)
+}
+
+func (s *Server) handleAdminHealth(w http.ResponseWriter, _ *http.Request, ctx *Ctx) error {
+	return RespondJSON(ctx.Context, w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+func (s *Server) handleAdminRoutes(w http.ResponseWriter, _ *http.Request, ctx *Ctx) error {
+	return RespondJSON(ctx.Context, w, s.Routes(), http.StatusOK)
+}
+
+// logLevels is the response of the loglevel admin endpoint
+type logLevels struct {
+	Level   string            `json:"level"`
+	Loggers map[string]string `json:"loggers,omitempty"` // levels set for named loggers, see vlog.Logger.Named
+}
+
+func (s *Server) handleAdminLogLevel(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+	query := r.URL.Query()
+	logger := query.Get("logger")
+
+	switch r.Method {
+	case http.MethodPut:
+		level := query.Get("level")
+		if !isLogLevel(level) {
+			return E(http.StatusBadRequest, "level must be one of trace, debug, info, warn, error or null")
+		}
+
+		var ttl time.Duration
+		if query.Has("ttl") {
+			var err error
+			if ttl, err = time.ParseDuration(query.Get("ttl")); err != nil || ttl <= 0 {
+				return E(http.StatusBadRequest, "ttl must be a positive duration such as 10m")
+			}
+		}
+
+		s.setLogLevel(logger, level, ttl)
+	case http.MethodDelete:
+		if logger == "" {
+			return E(http.StatusBadRequest, "logger is required")
+		}
+
+		s.setLogLevel(logger, "", 0)
+	}
+
+	return RespondJSON(ctx.Context, w, logLevels{Level: s.options.Logger.Level(), Loggers: s.options.Logger.NamedLevels()}, http.StatusOK)
+}
+
+// levelRevert is a pending change back to a logger's previous level, made once a level set with a TTL expires
+type levelRevert struct {
+	timer    *time.Timer
+	previous string
+}
+
+// setLogLevel sets the level of the named logger, or of the server's logger if name is empty. An empty level clears
+// the named logger's override. If ttl is non-zero the level reverts once it expires, to the level the logger had before
+// the first of any consecutive changes made with a TTL. Any change cancels a revert that is pending for the logger
+func (s *Server) setLogLevel(name, level string, ttl time.Duration) {
+	s.revertLock.Lock()
+	defer s.revertLock.Unlock()
+
+	previous := s.currentLogLevel(name)
+
+	if pending, exists := s.levelReverts[name]; exists {
+		pending.timer.Stop()
+		delete(s.levelReverts, name)
+
+		previous = pending.previous
+	}
+
+	if ttl > 0 && !s.revertsStopped {
+		revert := &levelRevert{previous: previous}
+		revert.timer = time.AfterFunc(ttl, func() { s.revertLogLevel(name, revert) })
+
+		s.levelReverts[name] = revert
+	}
+
+	s.applyLogLevel(name, level)
+
+	switch {
+	case level == "":
+		s.options.Logger.Info("log level override for", name, "removed by admin request")
+	case ttl > 0:
+		s.options.Logger.Info("log level", loggerLabel(name), "changed to", level, "for", ttl.String(), "by admin request")
+	default:
+		s.options.Logger.Info("log level", loggerLabel(name), "changed to", level, "by admin request")
+	}
+}
+
+// revertLogLevel puts a level revert into effect, unless it has since been cancelled
+func (s *Server) revertLogLevel(name string, revert *levelRevert) {
+	s.revertLock.Lock()
+	defer s.revertLock.Unlock()
+
+	if s.levelReverts[name] != revert {
+		return
+	}
+
+	delete(s.levelReverts, name)
+
+	s.applyLogLevel(name, revert.previous)
+	s.options.Logger.Info("log level", loggerLabel(name), "reverted to", logLevelOrDefault(revert.previous))
+}
+
+// cancelLogLevelRevert stops the pending revert for a logger, if there is one
+func (s *Server) cancelLogLevelRevert(name string) {
+	s.revertLock.Lock()
+	defer s.revertLock.Unlock()
+
+	if pending, exists := s.levelReverts[name]; exists {
+		pending.timer.Stop()
+		delete(s.levelReverts, name)
+	}
+}
+
+// stopLogLevelReverts stops every pending revert when the server is stopped, so that none fire after shutdown,
+// and keeps any more from being scheduled
+func (s *Server) stopLogLevelReverts() {
+	s.revertLock.Lock()
+	defer s.revertLock.Unlock()
+
+	for name, pending := range s.levelReverts {
+		pending.timer.Stop()
+		delete(s.levelReverts, name)
+	}
+
+	s.revertsStopped = true
+}
+
+func (s *Server) currentLogLevel(name string) string {
+	if name == "" {
+		return s.options.Logger.Level()
+	}
+
+	return s.options.Logger.NamedLevels()[name]
+}
+
+func (s *Server) applyLogLevel(name, level string) {
+	switch {
+	case name == "":
+		s.options.Logger.SetLevel(level)
+	case level == "":
+		s.options.Logger.ClearNamedLevel(name)
+	default:
+		s.options.Logger.SetNamedLevel(name, level)
+	}
+}
+
+func loggerLabel(name string) string {
+	if name == "" {
+		return "of server logger"
+	}
+
+	return "of logger " + name
+}
+
+func logLevelOrDefault(level string) string {
+	if level == "" {
+		return "the server's level"
+	}
+
+	return level
+}
+
+func (s *Server) handleAdminMetrics(w http.ResponseWriter, _ *http.Request, ctx *Ctx) error {
+	mem := runtime.MemStats{}
+	runtime.ReadMemStats(&mem)
+
+	buf := &strings.Builder{}
+
+	writeMetric(buf, "vk_uptime_seconds", "gauge", "Time since the server started.", time.Since(s.startedAt).Seconds())
+	writeMetric(buf, "go_goroutines", "gauge", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	writeMetric(buf, "go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.", float64(mem.Alloc))
+	writeMetric(buf, "go_memstats_sys_bytes", "gauge", "Number of bytes obtained from the system.", float64(mem.Sys))
+	writeMetric(buf, "go_gc_cycles_total", "counter", "Number of completed GC cycles.", float64(mem.NumGC))
+
+	if stats, ok := s.ConcurrencyStats(); ok {
+		writeMetric(buf, "vk_concurrency_in_flight", "gauge", "Requests currently being handled.", float64(stats.InFlight))
+		writeMetric(buf, "vk_concurrency_queued", "gauge", "Requests waiting for a concurrency slot.", float64(stats.Queued))
+		writeMetric(buf, "vk_concurrency_shed_total", "counter", "Requests shed by the concurrency limit.", float64(stats.Shed))
+	}
+
+	suppressed := s.options.Logger.Suppressed()
+	writeMetric(buf, "vk_log_sampled_total", "counter", "Logs suppressed by the sampling policy.", float64(suppressed.Sampled))
+	writeMetric(buf, "vk_log_deduplicated_total", "counter", "Repeated logs collapsed into summaries.", float64(suppressed.Deduplicated))
+	writeMetric(buf, "vk_log_dropped_total", "counter", "Logs dropped because a buffer was full.", float64(s.options.Logger.Dropped()))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	return respondBytes(ctx.Context, w, []byte(buf.String()), http.StatusOK)
+}
+
+// writeMetric writes a single metric in the Prometheus text exposition format
+func writeMetric(buf *strings.Builder, name, kind, help string, value float64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+// handlePprof dispatches to the net/http/pprof handlers, as httprouter can't mount them alongside its index
+func handlePprof(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/debug/pprof") {
+	case "/cmdline":
+		pprof.Cmdline(w, r)
+	case "/profile":
+		pprof.Profile(w, r)
+	case "/symbol":
+		pprof.Symbol(w, r)
+	case "/trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Index(w, r)
+	}
+}
@@ -0,0 +1,133 @@
+package vk
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/suborbital/vektor/vlog"
+)
+
+const defaultAutocertCacheDir = "~/.autocert"
+
+// autocertDomains returns the configured domains with duplicates removed
+func (o *Options) autocertDomains() []string {
+	domains := []string{}
+	seen := map[string]bool{}
+
+	for _, domain := range append([]string{o.Domain}, o.Domains...) {
+		if domain == "" || seen[domain] {
+			continue
+		}
+
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+
+	return domains
+}
+
+// newAutocertManager creates an autocert.Manager from the options
+func newAutocertManager(options *Options) *autocert.Manager {
+	cache := options.AutocertCache
+	if cache == nil {
+		dir := options.AutocertCacheDir
+		if dir == "" {
+			dir = defaultAutocertCacheDir
+		}
+
+		cache = autocert.DirCache(expandHome(dir, options.Logger))
+	}
+
+	m := &autocert.Manager{
+		Cache:      &loggingCache{Cache: cache, log: options.Logger},
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(options.autocertDomains()...),
+		Email:      options.ACMEEmail,
+	}
+
+	if options.ACMEDirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: options.ACMEDirectoryURL}
+	}
+
+	return m
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory
+func expandHome(path string, log *vlog.Logger) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.ErrorString("[vk] failed to determine home directory for autocert cache, using the working directory:", err.Error())
+		home = "."
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// loggingCache wraps an autocert.Cache to log certificates as they are obtained and renewed, as autocert.Manager
+// does not otherwise report them
+type loggingCache struct {
+	autocert.Cache
+	log *vlog.Logger
+}
+
+// Put implements autocert.Cache
+func (l *loggingCache) Put(ctx context.Context, key string, data []byte) error {
+	// autocert stores its ACME account key and challenge tokens alongside the certificates, which are keyed by domain
+	leaf := leafFromPEM(data)
+	if leaf == nil {
+		return l.Cache.Put(ctx, key, data)
+	}
+
+	_, err := l.Cache.Get(ctx, key)
+	renewal := err == nil
+
+	if err := l.Cache.Put(ctx, key, data); err != nil {
+		l.log.ErrorString("[vk] failed to cache TLS certificate for", key, "-", err.Error())
+		return err
+	}
+
+	expiry := leaf.NotAfter.Format(time.RFC3339)
+
+	if renewal {
+		l.log.Info("renewed TLS certificate for", key, "expiring", expiry)
+	} else {
+		l.log.Info("obtained TLS certificate for", key, "expiring", expiry)
+	}
+
+	return nil
+}
+
+// leafFromPEM returns the first certificate in data, which autocert stores as a private key followed by the chain
+func leafFromPEM(data []byte) *x509.Certificate {
+	for {
+		var block *pem.Block
+
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+
+		return leaf
+	}
+}
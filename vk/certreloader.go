@@ -0,0 +1,138 @@
+package vk
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/suborbital/vektor/vlog"
+)
+
+const defaultCertReloadInterval = 10 * time.Second
+
+// certReloader serves a certificate loaded from files, reloading it when the files change. Invalid
+// key pairs are rejected and the previous certificate continues to be served
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	log      *vlog.Logger
+
+	cert      atomic.Pointer[tls.Certificate]
+	certPEM   []byte // the file contents last loaded (or attempted)
+	keyPEM    []byte
+	stop      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// newCertReloader creates a certReloader and attempts the initial load, logging any failure
+func newCertReloader(certFile, keyFile string, interval time.Duration, log *vlog.Logger) *certReloader {
+	if interval <= 0 {
+		interval = defaultCertReloadInterval
+	}
+
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		log:      log,
+		stop:     make(chan struct{}),
+	}
+
+	if err := c.reload(); err != nil {
+		c.log.Error(err)
+	}
+
+	return c
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := c.cert.Load()
+	if cert == nil {
+		return nil, fmt.Errorf("no valid certificate loaded from %s", c.certFile)
+	}
+
+	return cert, nil
+}
+
+// start begins polling the files for changes until stopped
+func (c *certReloader) start() {
+	c.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(c.interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					if err := c.reload(); err != nil {
+						c.log.Error(err)
+					}
+				case <-c.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// shutdown stops polling the files
+func (c *certReloader) shutdown() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+// reload loads the key pair if the files have changed since they were last loaded, and swaps it in if it is valid.
+// The files are read rather than stat'd as mounted secrets are often swapped via symlinks with unreliable mod times
+func (c *certReloader) reload() error {
+	certPEM, err := os.ReadFile(c.certFile)
+	if err != nil {
+		return fmt.Errorf("[vk] failed to read TLS certificate: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(c.keyFile)
+	if err != nil {
+		return fmt.Errorf("[vk] failed to read TLS key: %w", err)
+	}
+
+	if bytes.Equal(certPEM, c.certPEM) && bytes.Equal(keyPEM, c.keyPEM) {
+		return nil
+	}
+
+	// record the contents first, so that an invalid pair isn't retried until the files change again
+	c.certPEM, c.keyPEM = certPEM, keyPEM
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		if c.cert.Load() != nil {
+			return fmt.Errorf("[vk] failed to reload TLS certificate, continuing to use the previous certificate: %w", err)
+		}
+
+		return fmt.Errorf("[vk] failed to load TLS certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("[vk] failed to parse TLS certificate: %w", err)
+	}
+
+	cert.Leaf = leaf
+
+	previous := c.cert.Swap(&cert)
+
+	if previous == nil {
+		c.log.Info("loaded TLS certificate for", leaf.Subject.String(), "expiring", leaf.NotAfter.Format(time.RFC3339))
+	} else {
+		c.log.Info("rotated TLS certificate for", leaf.Subject.String(), "expiring", leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package vk
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const defaultShedRetryAfter = time.Second
+
+// ConcurrencyPolicy describes how many requests may be handled at once, and what happens to the rest
+type ConcurrencyPolicy struct {
+	MaxInFlight int           `yaml:"max_in_flight" toml:"max_in_flight" env:"CONCURRENCY_MAX_IN_FLIGHT"` // requests handled concurrently, unlimited if zero or less
+	MaxQueue    int           `yaml:"max_queue" toml:"max_queue" env:"CONCURRENCY_MAX_QUEUE"`             // requests allowed to wait for a slot once MaxInFlight is reached
+	MaxWait     time.Duration `yaml:"max_wait" toml:"max_wait" env:"CONCURRENCY_MAX_WAIT"`                // how long a queued request waits before being shed
+	RetryAfter  time.Duration `yaml:"retry_after" toml:"retry_after" env:"CONCURRENCY_RETRY_AFTER"`       // advertised to shed clients via `Retry-After`, defaulting to 1s
+	Exempt      []string      `yaml:"exempt" toml:"exempt" env:"CONCURRENCY_EXEMPT"`                      // request paths that are never limited, such as health checks
+}
+
+// ConcurrencyStats is a snapshot of a ConcurrencyLimiter's state
+type ConcurrencyStats struct {
+	InFlight int64
+	Queued   int64
+	Shed     uint64
+}
+
+// ConcurrencyLimiter caps the number of requests being handled at once, queueing a bounded number of
+// requests for a bounded time and shedding the rest with a 503
+type ConcurrencyLimiter struct {
+	policy ConcurrencyPolicy
+	slots  chan struct{}
+	exempt atomic.Pointer[map[string]bool]
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+	shed     atomic.Uint64
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter for the provided policy. If MaxInFlight is zero or less
+// no requests are limited, but they are still counted in the limiter's stats
+func NewConcurrencyLimiter(policy ConcurrencyPolicy) *ConcurrencyLimiter {
+	if policy.RetryAfter == 0 {
+		policy.RetryAfter = defaultShedRetryAfter
+	}
+
+	c := &ConcurrencyLimiter{
+		policy: policy,
+	}
+
+	if policy.MaxInFlight > 0 {
+		c.slots = make(chan struct{}, policy.MaxInFlight)
+	}
+
+	c.setExempt(policy.Exempt)
+
+	return c
+}
+
+// setExempt replaces the set of paths that are never limited
+func (c *ConcurrencyLimiter) setExempt(paths []string) {
+	exempt := map[string]bool{}
+	for _, p := range paths {
+		exempt[p] = true
+	}
+
+	c.exempt.Store(&exempt)
+}
+
+// ConcurrencyLimit returns a Middleware that limits the concurrency of the routes it wraps. Use
+// NewConcurrencyLimiter directly if access to the limiter's stats is needed
+func ConcurrencyLimit(policy ConcurrencyPolicy) Middleware {
+	return NewConcurrencyLimiter(policy).Middleware()
+}
+
+// Middleware returns a Middleware that acquires a slot from the limiter before calling the
+// handler, responding with 503 and `Retry-After` if no slot becomes available in time. The limiter's stats
+// are available to the handler from Ctx.ConcurrencyStats
+func (c *ConcurrencyLimiter) Middleware() Middleware {
+	return func(inner HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+			ctx.concurrency = c
+
+			if (*c.exempt.Load())[r.URL.Path] {
+				return inner(w, r, ctx)
+			}
+
+			if !c.acquire(r) {
+				c.shed.Add(1)
+
+				ctx.RespHeaders.Set("Retry-After", strconv.Itoa(ceilSeconds(c.policy.RetryAfter)))
+
+				return E(http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+			}
+
+			defer c.release()
+
+			return inner(w, r, ctx)
+		}
+	}
+}
+
+// Stats returns the current number of in-flight and queued requests, and the total number shed
+func (c *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	stats := ConcurrencyStats{
+		InFlight: c.inFlight.Load(),
+		Queued:   c.queued.Load(),
+		Shed:     c.shed.Load(),
+	}
+
+	return stats
+}
+
+// acquire takes a slot, waiting in the queue if there is room, and returns false if the request should be shed
+func (c *ConcurrencyLimiter) acquire(r *http.Request) bool {
+	if c.slots == nil {
+		c.inFlight.Add(1)
+		return true
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+		c.inFlight.Add(1)
+		return true
+	default:
+	}
+
+	if c.policy.MaxWait <= 0 {
+		return false
+	}
+
+	if queued := c.queued.Add(1); queued > int64(c.policy.MaxQueue) {
+		c.queued.Add(-1)
+		return false
+	}
+
+	defer c.queued.Add(-1)
+
+	timer := time.NewTimer(c.policy.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case c.slots <- struct{}{}:
+		c.inFlight.Add(1)
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (c *ConcurrencyLimiter) release() {
+	c.inFlight.Add(-1)
+
+	if c.slots != nil {
+		<-c.slots
+	}
+}
@@ -0,0 +1,581 @@
+package vk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/suborbital/vektor/internal/env"
+	"github.com/suborbital/vektor/vlog"
+)
+
+const redactedValue = "[redacted]"
+
+// Config is the configuration for a Server and its logger that can be loaded from a file and the environment
+// by LoadConfig. Each field's file key is given by its yaml and toml tags (JSON files use the yaml keys), and
+// its environment variable by its env tag (after the prefix, VK_ by default). Switches are pointers and lists are
+// nil when unset, so that a file or variable can turn a switch off or empty a list. Fields tagged with redact are
+// hidden when the config is dumped, or have the credentials hidden if they are URLs
+type Config struct {
+	AppName               string            `yaml:"app_name" toml:"app_name" env:"APP_NAME"`
+	Domain                string            `yaml:"domain" toml:"domain" env:"DOMAIN"`
+	Domains               []string          `yaml:"domains" toml:"domains" env:"DOMAINS"`
+	AutocertCacheDir      string            `yaml:"autocert_cache_dir" toml:"autocert_cache_dir" env:"AUTOCERT_CACHE_DIR"`
+	ACMEDirectoryURL      string            `yaml:"acme_directory_url" toml:"acme_directory_url" env:"ACME_DIRECTORY_URL"`
+	ACMEEmail             string            `yaml:"acme_email" toml:"acme_email" env:"ACME_EMAIL" redact:"true"`
+	HTTPPort              int               `yaml:"http_port" toml:"http_port" env:"HTTP_PORT"`
+	TLSPort               int               `yaml:"tls_port" toml:"tls_port" env:"TLS_PORT"`
+	TLSCertFile           string            `yaml:"tls_cert_file" toml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile            string            `yaml:"tls_key_file" toml:"tls_key_file" env:"TLS_KEY_FILE"`
+	TLSCertReloadInterval time.Duration     `yaml:"tls_cert_reload_interval" toml:"tls_cert_reload_interval" env:"TLS_CERT_RELOAD_INTERVAL"`
+	ClientCAFile          string            `yaml:"tls_client_ca_file" toml:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	ClientAuth            string            `yaml:"tls_client_auth" toml:"tls_client_auth" env:"TLS_CLIENT_AUTH"`
+	ReadTimeout           time.Duration     `yaml:"read_timeout" toml:"read_timeout" env:"READ_TIMEOUT"`
+	ReadHeaderTimeout     time.Duration     `yaml:"read_header_timeout" toml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	WriteTimeout          time.Duration     `yaml:"write_timeout" toml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout           time.Duration     `yaml:"idle_timeout" toml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	MaxHeaderBytes        int               `yaml:"max_header_bytes" toml:"max_header_bytes" env:"MAX_HEADER_BYTES"`
+	DisableKeepAlives     *bool             `yaml:"disable_keep_alives" toml:"disable_keep_alives" env:"DISABLE_KEEP_ALIVES"`
+	BindAddress           string            `yaml:"bind_address" toml:"bind_address" env:"BIND_ADDRESS"`
+	UnixSockets           []string          `yaml:"unix_sockets" toml:"unix_sockets" env:"UNIX_SOCKETS"`
+	ServeHTTPWithTLS      *bool             `yaml:"serve_http_with_tls" toml:"serve_http_with_tls" env:"SERVE_HTTP_WITH_TLS"`
+	RedirectHTTP          *bool             `yaml:"redirect_http" toml:"redirect_http" env:"REDIRECT_HTTP"`
+	H2C                   *bool             `yaml:"h2c" toml:"h2c" env:"H2C"`
+	HTTP2                 HTTP2Settings     `yaml:"http2" toml:"http2"`
+	QuietRoutes           []string          `yaml:"quiet_routes" toml:"quiet_routes" env:"QUIET_ROUTES"`
+	FallbackAddress       string            `yaml:"fallback_address" toml:"fallback_address" env:"FALLBACK_ADDRESS" redact:"userinfo"`
+	CORSOrigins           []string          `yaml:"cors_origins" toml:"cors_origins" env:"CORS_ORIGINS"`
+	RateLimit             RateLimitConfig   `yaml:"rate_limit" toml:"rate_limit"`
+	ReloadOnSIGHUP        *bool             `yaml:"reload_on_sighup" toml:"reload_on_sighup" env:"RELOAD_ON_SIGHUP"`
+	AdminPort             int               `yaml:"admin_port" toml:"admin_port" env:"ADMIN_PORT"`
+	AdminBindAddress      string            `yaml:"admin_bind_address" toml:"admin_bind_address" env:"ADMIN_BIND_ADDRESS"`
+	AdminEndpoints        []string          `yaml:"admin_endpoints" toml:"admin_endpoints" env:"ADMIN_ENDPOINTS"`
+	Concurrency           ConcurrencyPolicy `yaml:"concurrency" toml:"concurrency"`
+	Log                   LogConfig         `yaml:"log" toml:"log"`
+
+	path string // the file the config was loaded from, if any
+}
+
+// RateLimitConfig configures a server-wide rate limit, counted against each client's IP address.
+// The limit is enabled once both Limit and Window are set
+type RateLimitConfig struct {
+	Limit     int           `yaml:"limit" toml:"limit" env:"RATE_LIMIT"`
+	Window    time.Duration `yaml:"window" toml:"window" env:"RATE_LIMIT_WINDOW"`
+	Algorithm string        `yaml:"algorithm" toml:"algorithm" env:"RATE_LIMIT_ALGORITHM"` // token_bucket (the default) or sliding_window
+}
+
+// LogConfig is the configuration for the Server's logger. It is only used if no logger is set with UseLogger
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	File   string `yaml:"file" toml:"file" env:"LOG_FILE"`
+	Prefix string `yaml:"prefix" toml:"prefix" env:"LOG_PREFIX"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"` // json (the default), text, logfmt or pretty
+}
+
+// ConfigError describes every problem found while loading or validating a Config
+type ConfigError struct {
+	Errors []error
+}
+
+// Error implements error
+func (c *ConfigError) Error() string {
+	msgs := make([]string, len(c.Errors))
+	for i, err := range c.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// LoadConfig loads a Config from the file at path, if path is not empty, and then applies overrides from VK_
+// environment variables. If path is empty the VK_CONFIG_FILE environment variable is used instead. Files may be
+// YAML, JSON or TOML, chosen by the file extension. All problems with the file, the environment and the resulting
+// config are reported together in a *ConfigError
+func LoadConfig(path string) (*Config, error) {
+	return LoadConfigWithEnvPrefix(path, defaultEnvPrefix)
+}
+
+// LoadConfigWithEnvPrefix is LoadConfig using a prefix other than VK_ for environment variables
+func LoadConfigWithEnvPrefix(path, prefix string) (*Config, error) {
+	if !strings.HasSuffix(prefix, "_") {
+		prefix = prefix + "_"
+	}
+
+	if path == "" {
+		path = os.Getenv(prefix + "CONFIG_FILE")
+	}
+
+	config := &Config{path: path}
+	errs := []error{}
+
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// variables that are present replace the values from the file
+	for _, err := range env.Load(prefix, config) {
+		errs = append(errs, fmt.Errorf("environment: %w", err))
+	}
+
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err.(*ConfigError).Errors...)
+	}
+
+	if len(errs) > 0 {
+		return nil, &ConfigError{Errors: errs}
+	}
+
+	return config, nil
+}
+
+// loadEnvConfig loads a Config from the environment, with only the settings that are present set
+func loadEnvConfig(prefix string) (*Config, error) {
+	config := &Config{}
+
+	if errs := env.Load(prefix, config); len(errs) > 0 {
+		return nil, &ConfigError{Errors: errs}
+	}
+
+	return config, nil
+}
+
+// readFile decodes the file at path into the config, rejecting any unknown keys
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = decodeYAML(data, c)
+	case ".json":
+		// durations are written as strings such as "10s" in every format, which encoding/json can't decode
+		// into a time.Duration, so JSON is converted to YAML (which it is a subset of) and decoded from there
+		var raw interface{}
+		if err = json.Unmarshal(data, &raw); err == nil {
+			if data, err = yaml.Marshal(raw); err == nil {
+				err = decodeYAML(data, c)
+			}
+		}
+	case ".toml":
+		var meta toml.MetaData
+		if meta, err = toml.Decode(string(data), c); err == nil {
+			if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown keys %v", undecoded)
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported format %q, must be .yaml, .yml, .json or .toml", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func decodeYAML(data []byte, c *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	return decoder.Decode(c)
+}
+
+// Validate checks the config for invalid values, returning a *ConfigError describing all of them
+func (c *Config) Validate() error {
+	errs := []error{}
+
+	for _, port := range []struct {
+		name  string
+		value int
+	}{{"http_port", c.HTTPPort}, {"tls_port", c.TLSPort}, {"admin_port", c.AdminPort}} {
+		if port.value < EphemeralPort || port.value > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be between 0 and 65535, or %d for an ephemeral port", port.name, EphemeralPort))
+		}
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls_cert_file and tls_key_file must be set together"))
+	}
+
+	if c.ClientAuth != "" {
+		if _, err := clientAuthFromString(c.ClientAuth); err != nil {
+			errs = append(errs, fmt.Errorf("tls_client_auth: %w", err))
+		}
+	}
+
+	if isSet(c.ServeHTTPWithTLS) && isSet(c.RedirectHTTP) {
+		errs = append(errs, fmt.Errorf("serve_http_with_tls and redirect_http cannot both be set"))
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"tls_cert_reload_interval", c.TLSCertReloadInterval},
+		{"read_timeout", c.ReadTimeout},
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"concurrency.max_wait", c.Concurrency.MaxWait},
+		{"concurrency.retry_after", c.Concurrency.RetryAfter},
+	}
+
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", d.name))
+		}
+	}
+
+	if c.MaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_header_bytes must not be negative"))
+	}
+
+	if c.Concurrency.MaxInFlight < 0 || c.Concurrency.MaxQueue < 0 {
+		errs = append(errs, fmt.Errorf("concurrency.max_in_flight and concurrency.max_queue must not be negative"))
+	}
+
+	if c.RateLimit.Limit < 0 || c.RateLimit.Window < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit.limit and rate_limit.window must not be negative"))
+	}
+
+	if c.RateLimit.Algorithm != "" {
+		if _, err := rateLimitAlgorithmFromString(c.RateLimit.Algorithm); err != nil {
+			errs = append(errs, fmt.Errorf("rate_limit.algorithm: %w", err))
+		}
+	}
+
+	for _, name := range c.AdminEndpoints {
+		if _, err := adminEndpointFromString(name); err != nil {
+			errs = append(errs, fmt.Errorf("admin_endpoints: %w", err))
+		}
+	}
+
+	if c.Log.Level != "" && !isLogLevel(c.Log.Level) {
+		errs = append(errs, fmt.Errorf("log.level must be one of trace, debug, info, warn, error or null"))
+	}
+
+	if c.Log.Format != "" && !isLogFormat(c.Log.Format) {
+		errs = append(errs, fmt.Errorf("log.format must be one of json, text, logfmt or pretty"))
+	}
+
+	if len(errs) > 0 {
+		return &ConfigError{Errors: errs}
+	}
+
+	return nil
+}
+
+// Dump returns the config as YAML with any secrets redacted, suitable for logging the effective configuration
+func (c *Config) Dump() ([]byte, error) {
+	redacted := *c
+	redactFields(reflect.ValueOf(&redacted).Elem())
+
+	return yaml.Marshal(&redacted)
+}
+
+// apply sets the fields of the config that are set (non-zero, or non-nil for switches and lists) on the options.
+// Invalid values are skipped, and should be caught by Validate
+func (c *Config) apply(o *Options) {
+	if c.AppName != "" {
+		o.AppName = c.AppName
+	}
+
+	if c.Domain != "" {
+		o.Domain = c.Domain
+	}
+
+	if c.Domains != nil {
+		o.Domains = c.Domains
+	}
+
+	if c.AutocertCacheDir != "" {
+		o.AutocertCacheDir = c.AutocertCacheDir
+	}
+
+	if c.ACMEDirectoryURL != "" {
+		o.ACMEDirectoryURL = c.ACMEDirectoryURL
+	}
+
+	if c.ACMEEmail != "" {
+		o.ACMEEmail = c.ACMEEmail
+	}
+
+	if c.HTTPPort != 0 {
+		o.HTTPPort = c.HTTPPort
+	}
+
+	if c.TLSPort != 0 {
+		o.TLSPort = c.TLSPort
+	}
+
+	if c.TLSCertFile != "" {
+		o.TLSCertFile = c.TLSCertFile
+	}
+
+	if c.TLSKeyFile != "" {
+		o.TLSKeyFile = c.TLSKeyFile
+	}
+
+	if c.TLSCertReloadInterval != 0 {
+		o.TLSCertReloadInterval = c.TLSCertReloadInterval
+	}
+
+	if c.ClientCAFile != "" {
+		o.ClientCAFile = c.ClientCAFile
+	}
+
+	if c.ClientAuth != "" {
+		if clientAuth, err := clientAuthFromString(c.ClientAuth); err == nil {
+			o.ClientAuth = clientAuth
+		}
+	}
+
+	if c.ReadTimeout != 0 {
+		o.ReadTimeout = c.ReadTimeout
+	}
+
+	if c.ReadHeaderTimeout != 0 {
+		o.ReadHeaderTimeout = c.ReadHeaderTimeout
+	}
+
+	if c.WriteTimeout != 0 {
+		o.WriteTimeout = c.WriteTimeout
+	}
+
+	if c.IdleTimeout != 0 {
+		o.IdleTimeout = c.IdleTimeout
+	}
+
+	if c.MaxHeaderBytes != 0 {
+		o.MaxHeaderBytes = c.MaxHeaderBytes
+	}
+
+	if c.DisableKeepAlives != nil {
+		o.DisableKeepAlives = *c.DisableKeepAlives
+	}
+
+	if c.BindAddress != "" {
+		o.BindAddress = c.BindAddress
+	}
+
+	if c.UnixSockets != nil {
+		o.UnixSockets = c.UnixSockets
+	}
+
+	if c.ServeHTTPWithTLS != nil {
+		o.ServeHTTPWithTLS = *c.ServeHTTPWithTLS
+	}
+
+	if c.RedirectHTTP != nil {
+		o.RedirectHTTP = *c.RedirectHTTP
+	}
+
+	if c.H2C != nil {
+		o.H2C = *c.H2C
+	}
+
+	overrideFields(reflect.ValueOf(&o.HTTP2).Elem(), reflect.ValueOf(c.HTTP2))
+
+	if c.QuietRoutes != nil {
+		o.QuietRoutes = c.QuietRoutes
+	}
+
+	if c.FallbackAddress != "" {
+		o.FallbackAddress = c.FallbackAddress
+	}
+
+	if c.CORSOrigins != nil {
+		o.CORSOrigins = c.CORSOrigins
+	}
+
+	if c.RateLimit != (RateLimitConfig{}) {
+		c.RateLimit.apply(o)
+	}
+
+	if c.ReloadOnSIGHUP != nil {
+		o.ReloadOnSIGHUP = *c.ReloadOnSIGHUP
+	}
+
+	if c.AdminPort != 0 {
+		o.AdminPort = c.AdminPort
+	}
+
+	if c.AdminBindAddress != "" {
+		o.AdminBindAddress = c.AdminBindAddress
+	}
+
+	if c.AdminEndpoints != nil {
+		o.AdminEndpoints = []AdminEndpoint{}
+
+		for _, name := range c.AdminEndpoints {
+			if endpoint, err := adminEndpointFromString(name); err == nil {
+				o.AdminEndpoints = append(o.AdminEndpoints, endpoint)
+			}
+		}
+	}
+
+	if !reflect.ValueOf(c.Concurrency).IsZero() {
+		policy := ConcurrencyPolicy{}
+		if o.Concurrency != nil {
+			policy = *o.Concurrency
+		}
+
+		overrideFields(reflect.ValueOf(&policy).Elem(), reflect.ValueOf(c.Concurrency))
+
+		if policy.MaxInFlight > 0 {
+			o.Concurrency = &policy
+		}
+	}
+
+	overrideFields(reflect.ValueOf(&o.logConfig).Elem(), reflect.ValueOf(c.Log))
+
+	if c.path != "" {
+		o.configFile = c.path
+	}
+}
+
+// apply sets the rate limit on the options, keeping the key func and store of any existing policy
+func (r RateLimitConfig) apply(o *Options) {
+	policy := RateLimitPolicy{}
+	if o.RateLimit != nil {
+		policy = *o.RateLimit
+	}
+
+	if r.Limit != 0 {
+		policy.Limit = r.Limit
+	}
+
+	if r.Window != 0 {
+		policy.Window = r.Window
+	}
+
+	if r.Algorithm != "" {
+		if algorithm, err := rateLimitAlgorithmFromString(r.Algorithm); err == nil {
+			policy.Algorithm = algorithm
+		}
+	}
+
+	if policy.Limit > 0 && policy.Window > 0 {
+		o.RateLimit = &policy
+	}
+}
+
+// modifiers returns the vlog options for the log config
+func (l LogConfig) modifiers(envPrefix string) []vlog.OptionsModifier {
+	mods := []vlog.OptionsModifier{vlog.EnvPrefix(envPrefix)}
+
+	if l.Level != "" {
+		mods = append(mods, vlog.Level(l.Level))
+	}
+
+	if l.File != "" {
+		mods = append(mods, vlog.ToFile(l.File))
+	}
+
+	if l.Prefix != "" {
+		mods = append(mods, vlog.LogPrefix(l.Prefix))
+	}
+
+	if l.Format != "" {
+		mods = append(mods, vlog.WithFormat(vlog.Format(l.Format)))
+	}
+
+	return mods
+}
+
+func isLogLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case vlog.LogLevelTrace, vlog.LogLevelDebug, vlog.LogLevelInfo, vlog.LogLevelWarn, vlog.LogLevelError, vlog.LogLevelNull:
+		return true
+	}
+
+	return false
+}
+
+func isLogFormat(format string) bool {
+	switch vlog.Format(strings.ToLower(format)) {
+	case vlog.FormatJSON, vlog.FormatText, vlog.FormatLogfmt, vlog.FormatPretty:
+		return true
+	}
+
+	return false
+}
+
+// overrideFields sets each field of dst to the matching field of src if it is non-zero, or non-nil for lists,
+// recursing into nested structs
+func overrideFields(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Field(i)
+
+		if !src.Type().Field(i).IsExported() {
+			continue
+		}
+
+		if field.Kind() == reflect.Struct {
+			overrideFields(dst.Field(i), field)
+		} else if field.Kind() == reflect.Slice && !field.IsNil() {
+			dst.Field(i).Set(field)
+		} else if !field.IsZero() {
+			dst.Field(i).Set(field)
+		}
+	}
+}
+
+// isSet returns true if a switch is set and turned on
+func isSet(b *bool) bool {
+	return b != nil && *b
+}
+
+// redactFields replaces the value of every non-empty string field tagged with redact, recursing into nested
+// structs. Fields tagged with redact:"userinfo" are URLs that only have their credentials replaced
+func redactFields(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			redactFields(field)
+			continue
+		}
+
+		if field.Kind() != reflect.String || field.String() == "" {
+			continue
+		}
+
+		switch v.Type().Field(i).Tag.Get("redact") {
+		case "true":
+			field.SetString(redactedValue)
+		case "userinfo":
+			field.SetString(redactUserinfo(field.String()))
+		}
+	}
+}
+
+// redactUserinfo replaces any credentials in a URL, or the whole value if it can't be parsed
+func redactUserinfo(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redactedValue
+	}
+
+	if u.User == nil {
+		return rawURL
+	}
+
+	u.User = nil
+
+	return strings.Replace(u.String(), "//", "//"+redactedValue+"@", 1)
+}
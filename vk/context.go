@@ -2,7 +2,10 @@ package vk
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
@@ -21,6 +24,11 @@ type Ctx struct {
 	RespHeaders http.Header
 	requestID   string
 	scope       interface{}
+	apiVersion  int
+
+	tlsState       *tls.ConnectionState
+	clientIdentity *ClientIdentity
+	concurrency    *ConcurrencyLimiter
 }
 
 // NewCtx creates a new Ctx
@@ -75,3 +83,65 @@ func (c *Ctx) RequestID() string {
 
 	return c.requestID
 }
+
+// APIVersion returns the API version selected for the request by a versioned RouteGroup, or 0 if the route is unversioned
+func (c *Ctx) APIVersion() int {
+	return c.apiVersion
+}
+
+// ConcurrencyStats returns the state of the concurrency limit applied to the request, such as the current
+// queue depth, or false if the request's route is not limited
+func (c *Ctx) ConcurrencyStats() (ConcurrencyStats, bool) {
+	if c.concurrency == nil {
+		return ConcurrencyStats{}, false
+	}
+
+	return c.concurrency.Stats(), true
+}
+
+// ClientIdentity returns the identity of the verified certificate the client presented over mutual TLS,
+// or nil if the request was not made over TLS or the client did not present a verified certificate
+func (c *Ctx) ClientIdentity() *ClientIdentity {
+	if c.clientIdentity == nil {
+		c.clientIdentity = newClientIdentity(c.tlsState)
+	}
+
+	return c.clientIdentity
+}
+
+// Param returns the raw value of the named path parameter, or an empty string if it is not set
+func (c *Ctx) Param(name string) string {
+	return c.Params.ByName(name)
+}
+
+// ParamInt returns the named path parameter as an int. If the parameter is missing
+// or is not an integer, a vk.Error with status 400 is returned
+func (c *Ctx) ParamInt(name string) (int, error) {
+	value := c.Params.ByName(name)
+	if value == "" {
+		return 0, E(http.StatusBadRequest, fmt.Sprintf("missing path parameter %s", name))
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, E(http.StatusBadRequest, fmt.Sprintf("path parameter %s must be an integer", name))
+	}
+
+	return i, nil
+}
+
+// ParamUUID returns the named path parameter as a UUID. If the parameter is missing
+// or is not a valid UUID, a vk.Error with status 400 is returned
+func (c *Ctx) ParamUUID(name string) (uuid.UUID, error) {
+	value := c.Params.ByName(name)
+	if value == "" {
+		return uuid.Nil, E(http.StatusBadRequest, fmt.Sprintf("missing path parameter %s", name))
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, E(http.StatusBadRequest, fmt.Sprintf("path parameter %s must be a UUID", name))
+	}
+
+	return id, nil
+}
@@ -12,12 +12,15 @@ type RouteGroup struct {
 	httpRoutes []httpRouteHandler
 	wsRoutes   []wsRouteHandler
 	middleware []Middleware
+	versioning *VersioningOptions
 }
 
 type httpRouteHandler struct {
 	Method  string
 	Path    string
 	Handler HandlerFunc
+
+	versions *versionRange // set for routes registered with RouteGroup.Versions
 }
 
 type wsRouteHandler struct {
@@ -105,9 +108,30 @@ func (g *RouteGroup) WithMiddlewares(middleware ...Middleware) *RouteGroup {
 // before calling the inner HandlerFunc. It can be called 'recursively'
 // since groups can be added to groups
 func (g *RouteGroup) httpRouteHandlers() []httpRouteHandler {
-	routes := make([]httpRouteHandler, len(g.httpRoutes))
+	unversioned := []httpRouteHandler{}
+	versioned := []httpRouteHandler{}
+
+	for _, r := range g.httpRoutes {
+		if r.versions != nil {
+			versioned = append(versioned, r)
+		} else {
+			unversioned = append(unversioned, r)
+		}
+	}
+
+	if len(versioned) > 0 {
+		versioning := g.versioning
+		if versioning == nil {
+			// Versions was used without WithVersioning, so use the defaults
+			versioning = newVersioningOptions()
+		}
+
+		unversioned = append(unversioned, versioning.versionedRouteHandlers(versioned)...)
+	}
+
+	routes := make([]httpRouteHandler, len(unversioned))
 
-	for i, r := range g.httpRoutes {
+	for i, r := range unversioned {
 		fullPath := fmt.Sprintf("%s%s", ensureLeadingSlash(g.prefix), ensureLeadingSlash(r.Path))
 		augR := httpRouteHandler{
 			Method:  r.Method,
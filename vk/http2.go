@@ -0,0 +1,56 @@
+package vk
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTTP2Settings tunes the server's HTTP/2 connections. Zero values use the golang.org/x/net/http2 defaults
+type HTTP2Settings struct {
+	MaxConcurrentStreams         uint32 `yaml:"max_concurrent_streams" toml:"max_concurrent_streams" env:"HTTP2_MAX_CONCURRENT_STREAMS"`
+	MaxReadFrameSize             uint32 `yaml:"max_read_frame_size" toml:"max_read_frame_size" env:"HTTP2_MAX_READ_FRAME_SIZE"`
+	MaxUploadBufferPerConnection int32  `yaml:"max_upload_buffer_per_connection" toml:"max_upload_buffer_per_connection" env:"HTTP2_MAX_UPLOAD_BUFFER_PER_CONNECTION"`
+	MaxUploadBufferPerStream     int32  `yaml:"max_upload_buffer_per_stream" toml:"max_upload_buffer_per_stream" env:"HTTP2_MAX_UPLOAD_BUFFER_PER_STREAM"`
+}
+
+// isSet returns true if any setting has been changed from its default
+func (h HTTP2Settings) isSet() bool {
+	return h != HTTP2Settings{}
+}
+
+func (h HTTP2Settings) http2Server() *http2.Server {
+	h2s := &http2.Server{
+		MaxConcurrentStreams:         h.MaxConcurrentStreams,
+		MaxReadFrameSize:             h.MaxReadFrameSize,
+		MaxUploadBufferPerConnection: h.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     h.MaxUploadBufferPerStream,
+	}
+
+	return h2s
+}
+
+// plainHandler wraps the handler for a listener serving without TLS, enabling h2c if configured
+func plainHandler(options *Options, handler http.Handler) http.Handler {
+	if !options.H2C {
+		return handler
+	}
+
+	return h2c.NewHandler(handler, options.HTTP2.http2Server())
+}
+
+// configureHTTP2 applies the HTTP/2 settings to a server that will serve TLS. If no settings have been changed,
+// the server is left alone and net/http's built in HTTP/2 support is used
+func configureHTTP2(options *Options, s *http.Server) {
+	if !options.HTTP2.isSet() {
+		return
+	}
+
+	// http2.ConfigureServer modifies the TLS config, so make sure it isn't one shared with the caller
+	s.TLSConfig = s.TLSConfig.Clone()
+
+	if err := http2.ConfigureServer(s, options.HTTP2.http2Server()); err != nil {
+		options.Logger.Error(err)
+	}
+}
@@ -0,0 +1,159 @@
+package vk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// serverListener pairs an http.Server with the address or listener it serves. Several serverListeners
+// may share one http.Server, and every one of them is served by the same vk.Server lifecycle
+type serverListener struct {
+	name     string // describes the listener in logs
+	server   *http.Server
+	network  string // the network to bind if listener is nil, "tcp" or "unix"
+	addr     string // the address to bind if listener is nil
+	listener net.Listener
+	useTLS   bool
+	certs    *certReloader // reloads the TLS certificate from files while serving, if configured
+}
+
+// bind opens the listener if it wasn't provided pre-opened
+func (sl *serverListener) bind() error {
+	if sl.listener != nil {
+		return nil
+	}
+
+	if sl.network == "unix" {
+		if err := removeStaleSocket(sl.addr); err != nil {
+			return err
+		}
+	}
+
+	l, err := net.Listen(sl.network, sl.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", sl.addr, err)
+	}
+
+	sl.listener = l
+
+	return nil
+}
+
+// serve serves the listener until the http.Server is shut down
+func (sl *serverListener) serve() error {
+	if sl.certs != nil {
+		sl.certs.start()
+		defer sl.certs.shutdown()
+	}
+
+	if sl.useTLS {
+		return sl.server.ServeTLS(sl.listener, "", "")
+	}
+
+	return sl.server.Serve(sl.listener)
+}
+
+// removeStaleSocket removes a Unix socket left behind by a previous process, refusing to remove anything else
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("cannot listen on %s: file exists and is not a socket", path)
+	}
+
+	return os.Remove(path)
+}
+
+// tcpAddr joins the configured bind address with a port
+func tcpAddr(options *Options, port int) string {
+	if port == EphemeralPort {
+		port = 0
+	}
+
+	return net.JoinHostPort(options.BindAddress, strconv.Itoa(port))
+}
+
+// adminTCPAddr joins the admin bind address, or the loopback address if it is unset, with the admin port
+func adminTCPAddr(options *Options) string {
+	bindAddress := options.AdminBindAddress
+	if bindAddress == "" {
+		bindAddress = defaultAdminBindAddress
+	}
+
+	port := options.AdminPort
+	if port == EphemeralPort {
+		port = 0
+	}
+
+	return net.JoinHostPort(bindAddress, strconv.Itoa(port))
+}
+
+// extraListeners creates the listeners for pre-opened listeners and Unix sockets, which serve plain HTTP
+func extraListeners(options *Options, handler http.Handler) []*serverListener {
+	if !options.hasExtraListeners() {
+		return nil
+	}
+
+	server := newGoServer(options, "", plainHandler(options, handler))
+
+	listeners := []*serverListener{}
+
+	for _, l := range options.Listeners {
+		listeners = append(listeners, &serverListener{name: "HTTP", server: server, listener: l})
+	}
+
+	for _, path := range options.UnixSockets {
+		listeners = append(listeners, &serverListener{name: "HTTP", server: server, network: "unix", addr: path})
+	}
+
+	return listeners
+}
+
+// httpsRedirectHandler redirects every request to the same host and path over HTTPS, on the port tlsListener is bound to
+func httpsRedirectHandler(tlsListener *serverListener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if tcpAddr, ok := tlsListener.listener.Addr().(*net.TCPAddr); ok && tcpAddr.Port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(tcpAddr.Port))
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// shutdownServers gracefully shuts down each distinct http.Server used by the listeners, returning the first error
+func shutdownServers(ctx context.Context, listeners []*serverListener) error {
+	var firstErr error
+
+	seen := map[*http.Server]bool{}
+
+	for _, sl := range listeners {
+		if seen[sl.server] {
+			continue
+		}
+
+		seen[sl.server] = true
+
+		if err := sl.server.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -70,11 +70,14 @@ func CORSHandler(domain string) HandlerFunc {
 	}
 }
 
+// corsAllowHeaders are the request headers allowed for cross-origin requests
+const corsAllowHeaders = "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, cache-control"
+
 func enableCors(ctx *Ctx, domain string) {
 	if domain != "" {
 		ctx.RespHeaders.Set("Access-Control-Allow-Origin", domain)
 		ctx.RespHeaders.Set("X-Requested-With", "XMLHttpRequest")
-		ctx.RespHeaders.Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization, cache-control")
+		ctx.RespHeaders.Set("Access-Control-Allow-Headers", corsAllowHeaders)
 	}
 }
 
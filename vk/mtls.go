@@ -0,0 +1,153 @@
+package vk
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// ClientAuthRequire and ClientAuthOptional are the accepted values for the TLS_CLIENT_AUTH env var
+const (
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+)
+
+// ClientIdentity describes the verified certificate presented by a client over mutual TLS
+type ClientIdentity struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []*url.URL
+	SPIFFEID       string // the client's spiffe:// URI SAN, if it has one
+	Certificate    *x509.Certificate
+}
+
+// newClientIdentity returns the identity of the verified client certificate in state, or nil if there isn't one.
+// Certificates that were presented but not verified against the client CAs are ignored
+func newClientIdentity(state *tls.ConnectionState) *ClientIdentity {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	cert := state.PeerCertificates[0]
+
+	id := &ClientIdentity{
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}
+
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			id.SPIFFEID = uri.String()
+			break
+		}
+	}
+
+	return id
+}
+
+// names returns every name the identity can be matched by: its SPIFFE ID, common name, DNS and email SANs
+func (c *ClientIdentity) names() []string {
+	names := []string{}
+
+	if c.SPIFFEID != "" {
+		names = append(names, c.SPIFFEID)
+	}
+
+	if c.Subject.CommonName != "" {
+		names = append(names, c.Subject.CommonName)
+	}
+
+	names = append(names, c.DNSNames...)
+	names = append(names, c.EmailAddresses...)
+
+	return names
+}
+
+// AuthorizeClient returns a Middleware that only allows requests from clients that presented a verified certificate
+// with a SPIFFE ID, common name, DNS or email SAN matching one of the provided patterns. Patterns use path.Match
+// syntax, so `spiffe://example.org/ns/prod/sa/*` matches any service account in the prod namespace. Requests
+// without a verified client certificate receive a 401, and those with a non-matching identity receive a 403
+func AuthorizeClient(patterns ...string) Middleware {
+	return func(inner HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+			id := ctx.ClientIdentity()
+			if id == nil {
+				return E(http.StatusUnauthorized, "client certificate required")
+			}
+
+			for _, name := range id.names() {
+				for _, pattern := range patterns {
+					if matched, _ := path.Match(pattern, name); matched {
+						return inner(w, r, ctx)
+					}
+				}
+			}
+
+			return E(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		}
+	}
+}
+
+// configureClientAuth applies the client certificate options to a TLS config, returning a new config if anything changed
+func configureClientAuth(options *Options, tlsConfig *tls.Config) *tls.Config {
+	if options.ClientCAs == nil && options.ClientCAFile == "" {
+		return tlsConfig
+	}
+
+	pool := options.ClientCAs
+	if pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if options.ClientCAFile != "" {
+		if err := appendCAFile(pool, options.ClientCAFile); err != nil {
+			// an empty pool rejects every client, so failing here fails closed
+			options.Logger.Error(err)
+		}
+	}
+
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = options.ClientAuth
+
+	if tlsConfig.ClientAuth == tls.NoClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig
+}
+
+func appendCAFile(pool *x509.CertPool, file string) error {
+	pemBytes, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("[vk] failed to read client CA file: %w", err)
+	}
+
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return fmt.Errorf("[vk] no certificates found in client CA file %s", file)
+	}
+
+	return nil
+}
+
+// clientAuthFromString converts the TLS_CLIENT_AUTH env var into a tls.ClientAuthType
+func clientAuthFromString(mode string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(mode) {
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	}
+
+	return tls.NoClientCert, fmt.Errorf("invalid client auth mode %q, must be one of %s or %s", mode, ClientAuthRequire, ClientAuthOptional)
+}
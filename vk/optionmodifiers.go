@@ -1,8 +1,15 @@
 package vk
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net"
 	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/suborbital/vektor/vlog"
 )
@@ -10,6 +17,19 @@ import (
 // OptionsModifier takes an options struct and returns a modified Options struct
 type OptionsModifier func(*Options)
 
+// UseConfig applies a Config, such as one loaded with LoadConfig. Only the settings that are set in the config are
+// applied (see Config), and its log settings are only used if no logger is set with UseLogger
+func UseConfig(config *Config) OptionsModifier {
+	return func(o *Options) {
+		if o.reloadedConfig != nil {
+			o.reloadedConfig.apply(o)
+			return
+		}
+
+		config.apply(o)
+	}
+}
+
 // UseDomain sets the server to use a particular domain for TLS
 func UseDomain(domain string) OptionsModifier {
 	return func(o *Options) {
@@ -17,6 +37,44 @@ func UseDomain(domain string) OptionsModifier {
 	}
 }
 
+// UseDomains sets the server to obtain TLS certificates for several domains, in addition to any set with UseDomain
+func UseDomains(domains ...string) OptionsModifier {
+	return func(o *Options) {
+		o.Domains = append(o.Domains, domains...)
+	}
+}
+
+// UseAutocertCacheDir sets the directory in which certificates obtained for the Domain option are cached.
+// A leading ~ is expanded to the user's home directory, and the default is ~/.autocert
+func UseAutocertCacheDir(dir string) OptionsModifier {
+	return func(o *Options) {
+		o.AutocertCacheDir = dir
+	}
+}
+
+// UseAutocertCache sets a custom cache for certificates obtained for the Domain option, such as one backed
+// by a shared store when running several replicas. This takes precedence over UseAutocertCacheDir
+func UseAutocertCache(cache autocert.Cache) OptionsModifier {
+	return func(o *Options) {
+		o.AutocertCache = cache
+	}
+}
+
+// UseACMEDirectory sets the ACME directory URL used to obtain certificates for the Domain option, such as
+// Let's Encrypt staging or a local Pebble server. Let's Encrypt production is used by default
+func UseACMEDirectory(url string) OptionsModifier {
+	return func(o *Options) {
+		o.ACMEDirectoryURL = url
+	}
+}
+
+// UseACMEEmail sets the contact email registered with the ACME provider, used to notify about problems with certificates
+func UseACMEEmail(email string) OptionsModifier {
+	return func(o *Options) {
+		o.ACMEEmail = email
+	}
+}
+
 // UseTLSConfig sets a TLS config that will be used for HTTPS
 // This will take precedence over the Domain option in all cases
 func UseTLSConfig(config *tls.Config) OptionsModifier {
@@ -25,7 +83,50 @@ func UseTLSConfig(config *tls.Config) OptionsModifier {
 	}
 }
 
+// UseTLSCertFiles serves HTTPS using the certificate and key in the provided PEM files. The files are
+// checked for changes periodically (every 10s by default) and the certificate is swapped in without
+// a restart, making this suitable for certificates rotated by tools such as cert-manager. This will
+// take precedence over the Domain option, and over any certificates included in a custom TLS config
+func UseTLSCertFiles(certFile, keyFile string) OptionsModifier {
+	return func(o *Options) {
+		o.TLSCertFile = certFile
+		o.TLSKeyFile = keyFile
+	}
+}
+
+// UseTLSCertReloadInterval sets how often the files passed to UseTLSCertFiles are checked for changes
+func UseTLSCertReloadInterval(interval time.Duration) OptionsModifier {
+	return func(o *Options) {
+		o.TLSCertReloadInterval = interval
+	}
+}
+
+// UseClientCAFile enables mutual TLS, verifying client certificates against the CA bundle in the provided PEM file.
+// Client certificates are required unless UseClientAuth says otherwise
+func UseClientCAFile(file string) OptionsModifier {
+	return func(o *Options) {
+		o.ClientCAFile = file
+	}
+}
+
+// UseClientCAs enables mutual TLS, verifying client certificates against the provided pool.
+// Client certificates are required unless UseClientAuth says otherwise
+func UseClientCAs(pool *x509.CertPool) OptionsModifier {
+	return func(o *Options) {
+		o.ClientCAs = pool
+	}
+}
+
+// UseClientAuth sets the policy for client certificates when mutual TLS is enabled, usually either
+// tls.RequireAndVerifyClientCert (the default) or tls.VerifyClientCertIfGiven
+func UseClientAuth(clientAuth tls.ClientAuthType) OptionsModifier {
+	return func(o *Options) {
+		o.ClientAuth = clientAuth
+	}
+}
+
 // UseTLSPort sets the HTTPS port to be used:
+// Pass EphemeralPort to have the OS choose a free port, which can be discovered with Server.Addr after starting
 func UseTLSPort(port int) OptionsModifier {
 	return func(o *Options) {
 		o.TLSPort = port
@@ -35,12 +136,131 @@ func UseTLSPort(port int) OptionsModifier {
 // UseHTTPPort sets the HTTP port to be used:
 // If domain is set, HTTP port will be used for LetsEncrypt challenge server
 // If domain is NOT set, this option will put VK in insecure HTTP mode
+// Pass EphemeralPort to have the OS choose a free port, which can be discovered with Server.Addr after starting
 func UseHTTPPort(port int) OptionsModifier {
 	return func(o *Options) {
 		o.HTTPPort = port
 	}
 }
 
+// UseReadTimeout sets the maximum duration for reading an entire request, including the body
+func UseReadTimeout(timeout time.Duration) OptionsModifier {
+	return func(o *Options) {
+		o.ReadTimeout = timeout
+	}
+}
+
+// UseReadHeaderTimeout sets the amount of time allowed to read request headers
+func UseReadHeaderTimeout(timeout time.Duration) OptionsModifier {
+	return func(o *Options) {
+		o.ReadHeaderTimeout = timeout
+	}
+}
+
+// UseWriteTimeout sets the maximum duration before timing out writes of the response
+func UseWriteTimeout(timeout time.Duration) OptionsModifier {
+	return func(o *Options) {
+		o.WriteTimeout = timeout
+	}
+}
+
+// UseIdleTimeout sets the maximum amount of time to wait for the next request when keep-alives are enabled
+func UseIdleTimeout(timeout time.Duration) OptionsModifier {
+	return func(o *Options) {
+		o.IdleTimeout = timeout
+	}
+}
+
+// UseMaxHeaderBytes sets the maximum number of bytes the server will read parsing the request header
+func UseMaxHeaderBytes(bytes int) OptionsModifier {
+	return func(o *Options) {
+		o.MaxHeaderBytes = bytes
+	}
+}
+
+// UseKeepAlives enables or disables HTTP keep-alives (they are enabled by default)
+func UseKeepAlives(enabled bool) OptionsModifier {
+	return func(o *Options) {
+		o.DisableKeepAlives = !enabled
+	}
+}
+
+// UseServerErrorLog sets the logger used by the underlying http.Server for errors accepting connections,
+// unexpected handler behaviour and underlying file system errors, instead of the server's vlog.Logger
+func UseServerErrorLog(logger *log.Logger) OptionsModifier {
+	return func(o *Options) {
+		o.ServerErrorLog = logger
+	}
+}
+
+// UseConnState sets a function to be called when a client connection changes state
+func UseConnState(fn func(net.Conn, http.ConnState)) OptionsModifier {
+	return func(o *Options) {
+		o.ConnState = fn
+	}
+}
+
+// UseBaseContext sets a function that returns the base context for incoming requests on a listener
+func UseBaseContext(fn func(net.Listener) context.Context) OptionsModifier {
+	return func(o *Options) {
+		o.BaseContext = fn
+	}
+}
+
+// UseBindAddress sets the host or IP address that the HTTP and TLS ports are bound to (all interfaces by default)
+func UseBindAddress(address string) OptionsModifier {
+	return func(o *Options) {
+		o.BindAddress = address
+	}
+}
+
+// UseListener adds a pre-opened listener (such as one passed in by systemd socket activation)
+// that the server will serve plain HTTP on, in addition to any configured ports
+func UseListener(listener net.Listener) OptionsModifier {
+	return func(o *Options) {
+		o.Listeners = append(o.Listeners, listener)
+	}
+}
+
+// UseUnixSocket adds a Unix socket that the server will serve plain HTTP on, in addition to any configured ports.
+// A stale socket left at path by a previous process is removed, and the socket is removed when the server stops
+func UseUnixSocket(path string) OptionsModifier {
+	return func(o *Options) {
+		o.UnixSockets = append(o.UnixSockets, path)
+	}
+}
+
+// UseHTTPWithTLS serves the server's routes over plain HTTP on the HTTP port as well as over HTTPS on the TLS port.
+// In domain mode, LetsEncrypt challenges continue to be answered on the HTTP port
+func UseHTTPWithTLS() OptionsModifier {
+	return func(o *Options) {
+		o.ServeHTTPWithTLS = true
+	}
+}
+
+// UseHTTPRedirect redirects all plain HTTP requests on the HTTP port to HTTPS when TLS is configured.
+// In domain mode, LetsEncrypt challenges continue to be answered on the HTTP port
+func UseHTTPRedirect() OptionsModifier {
+	return func(o *Options) {
+		o.RedirectHTTP = true
+	}
+}
+
+// UseH2C enables HTTP/2 cleartext (h2c) on the listeners that serve without TLS, for clients
+// (such as gRPC) that speak HTTP/2 with prior knowledge or upgrade from HTTP/1.1
+func UseH2C() OptionsModifier {
+	return func(o *Options) {
+		o.H2C = true
+	}
+}
+
+// UseHTTP2Settings tunes HTTP/2 connections, both over TLS and h2c
+func UseHTTP2Settings(settings HTTP2Settings) OptionsModifier {
+	return func(o *Options) {
+		o.HTTP2 = settings
+	}
+}
+
 // UseLogger allows a custom logger to be used
 func UseLogger(logger *vlog.Logger) OptionsModifier {
 	return func(o *Options) {
@@ -92,3 +312,68 @@ func UseFallbackAddress(address string) OptionsModifier {
 		o.FallbackAddress = address
 	}
 }
+
+// UseCORSOrigins enables CORS for every route, allowing requests from the provided origins. Pass "*" to allow
+// any origin. The origins can be changed while the server is running with Server.Reload
+func UseCORSOrigins(origins ...string) OptionsModifier {
+	return func(o *Options) {
+		o.CORSOrigins = origins
+	}
+}
+
+// UseRateLimit limits the requests handled by every route according to the policy. The policy's limit, window
+// and algorithm can be changed while the server is running with Server.Reload
+func UseRateLimit(policy RateLimitPolicy) OptionsModifier {
+	return func(o *Options) {
+		o.RateLimit = &policy
+	}
+}
+
+// UseReloadOnSIGHUP reloads the server's config when the process receives SIGHUP, see Server.Reload
+func UseReloadOnSIGHUP() OptionsModifier {
+	return func(o *Options) {
+		o.ReloadOnSIGHUP = true
+	}
+}
+
+// UseAdminServer serves operational endpoints such as health checks and metrics on a separate port, keeping them
+// off the public listeners. The admin server listens on 127.0.0.1 unless UseAdminBindAddress is used, and shares
+// the lifecycle of the other listeners. See AdminEndpoint for the endpoints served, and Server.AdminRouter to add more
+func UseAdminServer(port int) OptionsModifier {
+	return func(o *Options) {
+		o.AdminPort = port
+	}
+}
+
+// UseAdminBindAddress sets the address the admin server listens on, which is 127.0.0.1 by default.
+// The admin endpoints are unauthenticated, so they should only be reachable from a trusted network
+func UseAdminBindAddress(addr string) OptionsModifier {
+	return func(o *Options) {
+		o.AdminBindAddress = addr
+	}
+}
+
+// UseAdminEndpoints chooses which of the admin server's endpoints are served. By default all are served except pprof
+func UseAdminEndpoints(endpoints ...AdminEndpoint) OptionsModifier {
+	return func(o *Options) {
+		o.AdminEndpoints = endpoints
+	}
+}
+
+// UseMiddleware adds middleware that will be applied to every route handled by the server, such as RateLimit.
+// Server middleware runs inside the server's error handling, so any vk.Error it returns is rendered as usual
+func UseMiddleware(middleware ...Middleware) OptionsModifier {
+	return func(o *Options) {
+		o.Middleware = append(o.Middleware, middleware...)
+	}
+}
+
+// UseConcurrencyLimit caps the number of requests the server handles at once, queueing and then shedding
+// excess requests according to the policy. Quiet routes are always exempt from the limit, and a MaxInFlight
+// of zero or less leaves requests unlimited. The limit is applied after CORS, rate limiting and UseMiddleware,
+// so requests rejected by them don't wait for a slot
+func UseConcurrencyLimit(policy ConcurrencyPolicy) OptionsModifier {
+	return func(o *Options) {
+		o.Concurrency = &policy
+	}
+}
@@ -3,33 +3,91 @@ package vk
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-	"github.com/sethvargo/go-envconfig"
+	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/suborbital/vektor/vlog"
 )
 
+// EphemeralPort can be passed to UseHTTPPort or UseTLSPort to have the OS choose a free port when the server starts
+const EphemeralPort = -1
+
 // RouterWrapper provides a function signature to implement wrappers for routing. A good use case is to pass in an
 // opentelemetry mux wrapper.
 type RouterWrapper func(handler http.Handler) http.Handler
 
 // Options are the available options for Server
 type Options struct {
-	AppName         string `env:"APP_NAME"`
-	Domain          string `env:"DOMAIN"`
-	HTTPPort        int    `env:"HTTP_PORT"`
-	TLSPort         int    `env:"TLS_PORT"`
-	TLSConfig       *tls.Config
-	EnvPrefix       string
-	QuietRoutes     []string
-	Logger          *vlog.Logger
-	RouterWrapper   RouterWrapper
-	FallbackAddress string
+	AppName               string
+	Domain                string
+	Domains               []string
+	AutocertCacheDir      string
+	ACMEDirectoryURL      string
+	ACMEEmail             string
+	HTTPPort              int
+	TLSPort               int
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSCertReloadInterval time.Duration
+	ClientCAFile          string
+	ClientCAs             *x509.CertPool
+	ClientAuth            tls.ClientAuthType
+	ReadTimeout           time.Duration
+	ReadHeaderTimeout     time.Duration
+	WriteTimeout          time.Duration
+	IdleTimeout           time.Duration
+	MaxHeaderBytes        int
+	DisableKeepAlives     bool
+	BindAddress           string
+	UnixSockets           []string
+	ServeHTTPWithTLS      bool
+	RedirectHTTP          bool
+	H2C                   bool
+	HTTP2                 HTTP2Settings
+	Listeners             []net.Listener
+	TLSConfig             *tls.Config
+	AutocertCache         autocert.Cache
+	EnvPrefix             string
+	QuietRoutes           []string
+	Logger                *vlog.Logger
+	RouterWrapper         RouterWrapper
+	FallbackAddress       string
+	CORSOrigins           []string
+	RateLimit             *RateLimitPolicy
+	ReloadOnSIGHUP        bool
+	AdminPort             int
+	AdminBindAddress      string
+	AdminEndpoints        []AdminEndpoint
+	Middleware            []Middleware
+	Concurrency           *ConcurrencyPolicy
 
 	PreRouterInspector func(http.Request)
+
+	// ServerErrorLog, ConnState and BaseContext are passed through to the underlying http.Server.
+	// If ServerErrorLog is unset, the http.Server's errors are logged by Logger
+	ServerErrorLog *log.Logger
+	ConnState      func(net.Conn, http.ConnState)
+	BaseContext    func(net.Listener) context.Context
+
+	// logConfig configures the default logger, used if Logger is unset
+	logConfig LogConfig
+
+	// loggerFromConfig is set if Logger was created from logConfig rather than set with UseLogger
+	loggerFromConfig bool
+
+	// configFile and envPrefix are where the config is re-read from when the server is reloaded
+	configFile string
+	envPrefix  string
+
+	// reloadedConfig replaces the config passed to UseConfig while the options are rebuilt by Reload
+	reloadedConfig *Config
 }
 
 // defaultRouterWrapper is a default pass through option for a wrapper. This does not wrap the handler in anything.
@@ -38,7 +96,21 @@ var defaultRouterWrapper = func(innerHandler http.Handler) http.Handler {
 }
 
 func newOptsWithModifiers(mods ...OptionsModifier) *Options {
-	options := &Options{}
+	options := applyModifiers(nil, mods...)
+
+	envPrefix := defaultEnvPrefix
+	if options.EnvPrefix != "" {
+		envPrefix = options.EnvPrefix
+	}
+
+	options.finalize(envPrefix)
+
+	return options
+}
+
+// applyModifiers creates Options from the modifiers, using reloaded in place of the config passed to UseConfig if set
+func applyModifiers(reloaded *Config, mods ...OptionsModifier) *Options {
+	options := &Options{reloadedConfig: reloaded}
 
 	// set the default route wrapper to the noop pass through one.
 	options.RouterWrapper = defaultRouterWrapper
@@ -49,19 +121,14 @@ func newOptsWithModifiers(mods ...OptionsModifier) *Options {
 		mod(options)
 	}
 
-	envPrefix := defaultEnvPrefix
-	if options.EnvPrefix != "" {
-		envPrefix = options.EnvPrefix
-	}
-
-	options.finalize(envPrefix)
+	options.reloadedConfig = nil
 
 	return options
 }
 
-// ShouldUseTLS returns true if domain is set and/or TLS is configured
+// ShouldUseTLS returns true if a domain is set and/or TLS is configured
 func (o *Options) ShouldUseTLS() bool {
-	return o.Domain != "" || o.TLSConfig != nil
+	return o.Domain != "" || len(o.Domains) > 0 || o.TLSConfig != nil || o.TLSCertFile != ""
 }
 
 // HTTPPortSet returns true if the HTTP port is set
@@ -74,6 +141,11 @@ func (o *Options) ShouldUseHTTP() bool {
 	return !o.ShouldUseTLS() && o.HTTPPortSet()
 }
 
+// hasExtraListeners returns true if pre-opened listeners or Unix sockets are configured
+func (o *Options) hasExtraListeners() bool {
+	return len(o.Listeners) > 0 || len(o.UnixSockets) > 0
+}
+
 // finalize "locks in" the options by overriding any existing options with the version from the environment, and setting the default logger if needed
 func (o *Options) finalize(prefix string) {
 	// Append trailing _ if prefix is missing one
@@ -81,8 +153,13 @@ func (o *Options) finalize(prefix string) {
 		prefix = prefix + "_"
 	}
 
+	o.envPrefix = prefix
+
+	envErr := o.applyEnv()
+
 	if o.Logger == nil {
-		o.Logger = vlog.Default(vlog.EnvPrefix(prefix))
+		o.Logger = vlog.Default(o.logConfig.modifiers(prefix)...)
+		o.loggerFromConfig = true
 	}
 
 	// if no inspector was set, create an empty one
@@ -90,29 +167,24 @@ func (o *Options) finalize(prefix string) {
 		o.PreRouterInspector = func(_ http.Request) {}
 	}
 
-	envOpts := Options{}
-	if err := envconfig.ProcessWith(context.Background(), &envOpts, envconfig.PrefixLookuper(prefix, envconfig.OsLookuper())); err != nil {
-		o.Logger.Error(errors.Wrap(err, "[vk] failed to ProcessWith environment config"))
-		return
+	if envErr != nil {
+		o.Logger.Error(errors.Wrap(envErr, "[vk] ignoring invalid environment config"))
 	}
-
-	o.replaceFieldsIfNeeded(&envOpts)
 }
 
-func (o *Options) replaceFieldsIfNeeded(replacement *Options) {
-	if replacement.AppName != "" {
-		o.AppName = replacement.AppName
+// applyEnv overrides the options with the config from the environment. An invalid environment is ignored
+// entirely rather than partially applied, and its error is returned
+func (o *Options) applyEnv() error {
+	envConfig, err := loadEnvConfig(o.envPrefix)
+	if err == nil {
+		err = envConfig.Validate()
 	}
 
-	if replacement.Domain != "" {
-		o.Domain = replacement.Domain
+	if err != nil {
+		return err
 	}
 
-	if replacement.HTTPPort != 0 {
-		o.HTTPPort = replacement.HTTPPort
-	}
+	envConfig.apply(o)
 
-	if replacement.TLSPort != 0 {
-		o.TLSPort = replacement.TLSPort
-	}
+	return nil
 }
@@ -0,0 +1,102 @@
+package vk
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Constraint validates the raw string value of a path parameter, returning
+// an error describing why the value is invalid (or nil if it is acceptable)
+type Constraint func(value string) error
+
+// IsInt constrains a path parameter to base-10 integers
+func IsInt() Constraint {
+	return func(value string) error {
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+
+		return nil
+	}
+}
+
+// IsUUID constrains a path parameter to UUIDs
+func IsUUID() Constraint {
+	return func(value string) error {
+		if _, err := uuid.Parse(value); err != nil {
+			return fmt.Errorf("%q is not a UUID", value)
+		}
+
+		return nil
+	}
+}
+
+// MatchesRegex constrains a path parameter to values matching the provided expression in full.
+// The expression is compiled when the constraint is created, and an invalid expression will panic
+// so that it is caught when routes are registered rather than when requests are served
+func MatchesRegex(expr string) Constraint {
+	re := regexp.MustCompile(fmt.Sprintf("^(?:%s)$", expr))
+
+	return func(value string) error {
+		if !re.MatchString(value) {
+			return fmt.Errorf("%q does not match %s", value, expr)
+		}
+
+		return nil
+	}
+}
+
+// IsOneOf constrains a path parameter to one of a fixed set of values
+func IsOneOf(values ...string) Constraint {
+	allowed := make(map[string]bool, len(values))
+	for _, v := range values {
+		allowed[v] = true
+	}
+
+	return func(value string) error {
+		if !allowed[value] {
+			return fmt.Errorf("%q is not one of [%s]", value, strings.Join(values, ", "))
+		}
+
+		return nil
+	}
+}
+
+// ConstrainParam returns a Middleware that checks the named path parameter against the provided
+// constraints before the handler is invoked. A request whose parameter does not satisfy every constraint
+// is treated as not matching the route at all, and receives a 404
+func ConstrainParam(name string, constraints ...Constraint) Middleware {
+	return paramMiddleware(http.StatusNotFound, name, constraints)
+}
+
+// ValidateParam returns a Middleware that checks the named path parameter against the provided
+// constraints before the handler is invoked. A request whose parameter does not satisfy every constraint
+// receives a 400 describing the first failed constraint
+func ValidateParam(name string, constraints ...Constraint) Middleware {
+	return paramMiddleware(http.StatusBadRequest, name, constraints)
+}
+
+func paramMiddleware(status int, name string, constraints []Constraint) Middleware {
+	return func(inner HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+			value := ctx.Params.ByName(name)
+
+			for _, c := range constraints {
+				if err := c(value); err != nil {
+					if status == http.StatusNotFound {
+						return E(status, http.StatusText(status))
+					}
+
+					return E(status, fmt.Sprintf("invalid path parameter %s: %s", name, err.Error()))
+				}
+			}
+
+			return inner(w, r, ctx)
+		}
+	}
+}
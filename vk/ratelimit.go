@@ -0,0 +1,337 @@
+package vk
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm selects how a RateLimitPolicy counts requests
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to Limit requests, refilling at Limit requests per Window
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Limit requests in any Window, weighting the previous window's count by its overlap
+	SlidingWindow
+)
+
+// rateLimitAlgorithmFromString converts an algorithm's config name into a RateLimitAlgorithm
+func rateLimitAlgorithmFromString(algorithm string) (RateLimitAlgorithm, error) {
+	switch strings.ToLower(algorithm) {
+	case "token_bucket":
+		return TokenBucket, nil
+	case "sliding_window":
+		return SlidingWindow, nil
+	}
+
+	return TokenBucket, fmt.Errorf("invalid algorithm %q, must be one of token_bucket or sliding_window", algorithm)
+}
+
+// RateLimitKeyFunc derives the key that a request is counted against
+type RateLimitKeyFunc func(*http.Request, *Ctx) string
+
+// RateLimitPolicy describes how requests are limited by the RateLimit middleware
+type RateLimitPolicy struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int
+	Window    time.Duration
+	Key       RateLimitKeyFunc // defaults to KeyByIP
+	Store     RateLimitStore   // defaults to a MemoryRateLimitStore holding up to 10,000 keys
+}
+
+// RateLimitResult is the outcome of counting a single request
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // time until the quota is fully restored
+	RetryAfter time.Duration // time until the next request would be allowed (when not Allowed)
+}
+
+// RateLimitStore counts requests for a key according to a policy. Implementations must be safe for concurrent use
+type RateLimitStore interface {
+	Allow(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error)
+}
+
+const defaultRateLimitMaxKeys = 10000
+
+// RateLimit returns a Middleware that limits requests according to the provided policy. Every response includes
+// the `RateLimit-Limit`, `RateLimit-Remaining` and `RateLimit-Reset` headers, and requests over the limit receive
+// a 429 vk.Error with a `Retry-After` header. If the store fails, the error is logged and the request is allowed
+func RateLimit(policy RateLimitPolicy) Middleware {
+	policy = policy.withDefaults()
+
+	return func(inner HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+			return limitRequest(policy, inner, w, r, ctx)
+		}
+	}
+}
+
+// withDefaults returns the policy with the default key func and store set if needed
+func (p RateLimitPolicy) withDefaults() RateLimitPolicy {
+	if p.Key == nil {
+		p.Key = KeyByIP()
+	}
+
+	if p.Store == nil {
+		p.Store = NewMemoryRateLimitStore(defaultRateLimitMaxKeys)
+	}
+
+	return p
+}
+
+// limitRequest counts the request against the policy, calling inner if it is allowed
+func limitRequest(policy RateLimitPolicy, inner HandlerFunc, w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+	result, err := policy.Store.Allow(policy.Key(r, ctx), policy, time.Now())
+	if err != nil {
+		ctx.Log.Error(fmt.Errorf("[vk] rate limit store failed, allowing request: %w", err))
+		return inner(w, r, ctx)
+	}
+
+	ctx.RespHeaders.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	ctx.RespHeaders.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	ctx.RespHeaders.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+	if !result.Allowed {
+		ctx.RespHeaders.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+
+		return E(http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+	}
+
+	return inner(w, r, ctx)
+}
+
+// KeyByIP counts requests against the client's IP address, taken from the connection's remote address
+func KeyByIP() RateLimitKeyFunc {
+	return func(r *http.Request, _ *Ctx) string {
+		return clientIP(r)
+	}
+}
+
+// KeyByHeader counts requests against the value of the named header (such as an API key),
+// falling back to the client's IP address for requests that do not include it
+func KeyByHeader(header string) RateLimitKeyFunc {
+	return func(r *http.Request, _ *Ctx) string {
+		if value := r.Header.Get(header); value != "" {
+			return header + ":" + value
+		}
+
+		return clientIP(r)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore is an in-memory RateLimitStore. Keys that have been idle for longer than two windows are
+// discarded, and once maxKeys is reached the least recently used key is evicted to make room for new ones
+type MemoryRateLimitStore struct {
+	maxKeys int
+	entries map[string]*list.Element
+	recency *list.List // front is most recently used
+	lock    sync.Mutex
+}
+
+type rateLimitEntry struct {
+	key      string
+	lastSeen time.Time
+	window   time.Duration
+
+	// token bucket state
+	tokens     float64
+	refilledAt time.Time
+
+	// sliding window state
+	windowStart time.Time
+	prevCount   int
+	currCount   int
+}
+
+// NewMemoryRateLimitStore creates a MemoryRateLimitStore holding at most maxKeys keys
+func NewMemoryRateLimitStore(maxKeys int) *MemoryRateLimitStore {
+	m := &MemoryRateLimitStore{
+		maxKeys: maxKeys,
+		entries: map[string]*list.Element{},
+		recency: list.New(),
+	}
+
+	return m
+}
+
+// Allow counts a request for key according to policy
+func (m *MemoryRateLimitStore) Allow(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	if policy.Limit < 1 || policy.Window <= 0 {
+		return RateLimitResult{}, fmt.Errorf("invalid rate limit policy: limit %d per %s", policy.Limit, policy.Window)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry := m.entryForKey(key, policy, now)
+	entry.lastSeen = now
+	entry.window = policy.Window
+
+	if policy.Algorithm == SlidingWindow {
+		return entry.slidingWindow(policy, now), nil
+	}
+
+	return entry.tokenBucket(policy, now), nil
+}
+
+// Len returns the number of keys currently held by the store
+func (m *MemoryRateLimitStore) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return len(m.entries)
+}
+
+// entryForKey returns the entry for key, creating it (and making room for it) if needed.
+// It must be called with the lock held
+func (m *MemoryRateLimitStore) entryForKey(key string, policy RateLimitPolicy, now time.Time) *rateLimitEntry {
+	if elem, exists := m.entries[key]; exists {
+		m.recency.MoveToFront(elem)
+		return elem.Value.(*rateLimitEntry)
+	}
+
+	m.evictIdle(now)
+
+	for m.maxKeys > 0 && len(m.entries) >= m.maxKeys {
+		oldest := m.recency.Back()
+		m.recency.Remove(oldest)
+		delete(m.entries, oldest.Value.(*rateLimitEntry).key)
+	}
+
+	entry := &rateLimitEntry{
+		key:         key,
+		tokens:      float64(policy.Limit),
+		refilledAt:  now,
+		windowStart: now,
+	}
+
+	m.entries[key] = m.recency.PushFront(entry)
+
+	return entry
+}
+
+// evictIdle removes entries that haven't been seen for two windows, which are indistinguishable
+// from new entries under either algorithm. It must be called with the lock held
+func (m *MemoryRateLimitStore) evictIdle(now time.Time) {
+	for elem := m.recency.Back(); elem != nil; {
+		entry := elem.Value.(*rateLimitEntry)
+		if now.Sub(entry.lastSeen) < entry.window*2 {
+			// everything in front of this element was seen more recently
+			return
+		}
+
+		prev := elem.Prev()
+		m.recency.Remove(elem)
+		delete(m.entries, entry.key)
+		elem = prev
+	}
+}
+
+func (e *rateLimitEntry) tokenBucket(policy RateLimitPolicy, now time.Time) RateLimitResult {
+	limit := float64(policy.Limit)
+	perToken := policy.Window / time.Duration(policy.Limit)
+
+	elapsed := now.Sub(e.refilledAt)
+	e.refilledAt = now
+	e.tokens = math.Min(limit, e.tokens+elapsed.Seconds()/perToken.Seconds())
+
+	result := RateLimitResult{Limit: policy.Limit}
+
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - e.tokens) * float64(perToken))
+	}
+
+	result.Remaining = int(math.Floor(e.tokens))
+	result.Reset = time.Duration((limit - e.tokens) * float64(perToken))
+
+	return result
+}
+
+func (e *rateLimitEntry) slidingWindow(policy RateLimitPolicy, now time.Time) RateLimitResult {
+	window := policy.Window
+	limit := float64(policy.Limit)
+
+	// advance to the window containing now
+	if elapsedWindows := now.Sub(e.windowStart) / window; elapsedWindows > 0 {
+		if elapsedWindows == 1 {
+			e.prevCount = e.currCount
+		} else {
+			e.prevCount = 0
+		}
+
+		e.currCount = 0
+		e.windowStart = e.windowStart.Add(elapsedWindows * window)
+	}
+
+	elapsed := now.Sub(e.windowStart)
+	overlap := 1 - float64(elapsed)/float64(window)
+	estimate := float64(e.prevCount)*overlap + float64(e.currCount)
+
+	result := RateLimitResult{
+		Limit: policy.Limit,
+		Reset: window - elapsed,
+	}
+
+	if estimate+1 <= limit {
+		e.currCount++
+		estimate++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = e.slidingRetryAfter(limit, window, elapsed)
+	}
+
+	result.Remaining = int(math.Max(0, math.Floor(limit-estimate)))
+
+	return result
+}
+
+// slidingRetryAfter calculates how long until the weighted count drops enough to allow another request
+func (e *rateLimitEntry) slidingRetryAfter(limit float64, window, elapsed time.Duration) time.Duration {
+	curr := float64(e.currCount)
+
+	if curr+1 <= limit && e.prevCount > 0 {
+		// the previous window's weight will decay enough within this window
+		needed := 1 - (limit-1-curr)/float64(e.prevCount)
+		return time.Duration(needed*float64(window)) - elapsed
+	}
+
+	// wait for the next window, where the current count becomes the decaying previous count
+	wait := window - elapsed
+	if curr > 0 {
+		needed := 1 - (limit-1)/curr
+		if needed > 0 {
+			wait += time.Duration(needed * float64(window))
+		}
+	}
+
+	return wait
+}
@@ -0,0 +1,310 @@
+package vk
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// runtimeSafeSettings are the config keys that Reload applies to a running server
+var runtimeSafeSettings = map[string]bool{
+	"log.level":        true,
+	"quiet_routes":     true,
+	"fallback_address": true,
+	"cors_origins":     true,
+	"rate_limit":       true,
+}
+
+// ReloadResult reports the settings that changed when the server was reloaded
+type ReloadResult struct {
+	Applied         []string `json:"applied"`          // settings that have taken effect
+	RestartRequired []string `json:"restart_required"` // settings that will only take effect once the server is restarted
+}
+
+// Reload re-reads the server's config from the environment, and from the config file if the server was configured
+// with a Config from LoadConfig. Changes to the log level, quiet routes, fallback address, CORS origins and rate limit
+// are applied immediately, and changes to any other setting are reported as requiring a restart. The server's options
+// are rebuilt from its OptionsModifiers with the re-read config in place of the one passed to UseConfig, so a setting
+// removed from the config returns to the value it would have had without it, except the log level, which returns to
+// the level the logger was created with. As with UseConfig, the log settings are ignored if the logger was set with
+// UseLogger. If the config is invalid nothing is changed
+func (s *Server) Reload() (*ReloadResult, error) {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	config, err := LoadConfigWithEnvPrefix(s.options.configFile, s.options.envPrefix)
+	if err != nil {
+		s.options.Logger.Error(fmt.Errorf("[vk] failed to reload config, keeping the current config: %w", err))
+		return nil, err
+	}
+
+	updated := applyModifiers(config, s.modifiers...)
+	updated.envPrefix = s.options.envPrefix
+
+	if err := updated.applyEnv(); err != nil {
+		s.options.Logger.Error(fmt.Errorf("[vk] failed to reload config, keeping the current config: %w", err))
+		return nil, err
+	}
+
+	result := &ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+
+	for _, setting := range changedSettings(s.reloaded, updated) {
+		// the log settings are only used for a logger created from the config, not one set with UseLogger
+		if strings.HasPrefix(setting, "log.") && !s.options.loggerFromConfig {
+			continue
+		}
+
+		if runtimeSafeSettings[setting] {
+			result.Applied = append(result.Applied, setting)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, setting)
+		}
+	}
+
+	for _, setting := range result.Applied {
+		s.applySetting(setting, updated)
+	}
+
+	if len(result.Applied) > 0 {
+		s.options.Logger.Info("reloaded config, applied changes to", strings.Join(result.Applied, ", "))
+	} else {
+		s.options.Logger.Info("reloaded config, no changes to apply")
+	}
+
+	if len(result.RestartRequired) > 0 {
+		s.options.Logger.Warn("config changes to", strings.Join(result.RestartRequired, ", "), "will take effect after a restart")
+	}
+
+	return result, nil
+}
+
+// ReloadHandler returns a HandlerFunc that reloads the server and responds with the ReloadResult as JSON.
+// It should only be mounted on an internal or authenticated route
+func (s *Server) ReloadHandler() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+		result, err := s.Reload()
+		if err != nil {
+			return E(http.StatusInternalServerError, err.Error())
+		}
+
+		return RespondJSON(ctx.Context, w, result, http.StatusOK)
+	}
+}
+
+// applySetting copies a runtime safe setting from updated into the reloaded options and puts it into effect.
+// It must be called with reloadLock held
+func (s *Server) applySetting(setting string, updated *Options) {
+	switch setting {
+	case "log.level":
+		s.reloaded.logConfig.Level = updated.logConfig.Level
+
+		level := updated.logConfig.Level
+		if level == "" {
+			level = s.logLevel
+		}
+
+		s.cancelLogLevelRevert("")
+		s.options.Logger.SetLevel(level)
+	case "quiet_routes":
+		s.reloaded.QuietRoutes = updated.QuietRoutes
+
+		s.lock.RLock()
+		s.internalRouter.useQuietRoutes(updated.QuietRoutes)
+		s.lock.RUnlock()
+
+		if s.concurrency != nil {
+			s.concurrency.setExempt(append(append([]string{}, s.options.Concurrency.Exempt...), updated.QuietRoutes...))
+		}
+	case "fallback_address":
+		s.reloaded.FallbackAddress = updated.FallbackAddress
+
+		s.lock.RLock()
+		s.internalRouter.useFallback(updated.FallbackAddress)
+		s.lock.RUnlock()
+	case "cors_origins":
+		s.reloaded.CORSOrigins = updated.CORSOrigins
+		s.runtime.useCORSOrigins(updated.CORSOrigins)
+
+		s.lock.RLock()
+		s.internalRouter.usePreflight(s.runtime.preflight())
+		s.lock.RUnlock()
+	case "rate_limit":
+		s.reloaded.RateLimit = updated.RateLimit
+		s.runtime.useRateLimit(updated.RateLimit)
+	}
+}
+
+// reloadOnSIGHUP reloads the server each time the process receives SIGHUP, until the server is stopped
+func (s *Server) reloadOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-signals:
+				s.options.Logger.Info("received SIGHUP, reloading config")
+
+				// errors are logged by Reload
+				_, _ = s.Reload()
+			case <-s.stopReload:
+				return
+			}
+		}
+	}()
+}
+
+// changedSettings returns the config key of every setting that differs between the two options
+func changedSettings(current, updated *Options) []string {
+	changed := []string{}
+
+	currentVal, updatedVal := reflect.ValueOf(current).Elem(), reflect.ValueOf(updated).Elem()
+	configType := reflect.TypeOf(Config{})
+
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Tag.Get("yaml")
+
+		switch field.Name {
+		case "Log":
+			logType := reflect.TypeOf(LogConfig{})
+			currentLog, updatedLog := reflect.ValueOf(current.logConfig), reflect.ValueOf(updated.logConfig)
+
+			for j := 0; j < logType.NumField(); j++ {
+				if currentLog.Field(j).Interface() != updatedLog.Field(j).Interface() {
+					changed = append(changed, name+"."+logType.Field(j).Tag.Get("yaml"))
+				}
+			}
+		case "RateLimit":
+			// policies contain funcs, which can't be compared
+			if rateLimitString(current.RateLimit) != rateLimitString(updated.RateLimit) {
+				changed = append(changed, name)
+			}
+		default:
+			if !reflect.DeepEqual(currentVal.FieldByName(field.Name).Interface(), updatedVal.FieldByName(field.Name).Interface()) {
+				changed = append(changed, name)
+			}
+		}
+	}
+
+	return changed
+}
+
+func rateLimitString(policy *RateLimitPolicy) string {
+	if policy == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d/%d/%s", policy.Algorithm, policy.Limit, policy.Window)
+}
+
+// runtimeSettings holds the server-wide CORS origins and rate limit, which can be changed by Reload
+type runtimeSettings struct {
+	corsOrigins atomic.Pointer[[]string]
+	rateLimit   atomic.Pointer[RateLimitPolicy]
+}
+
+func newRuntimeSettings(options *Options) *runtimeSettings {
+	rs := &runtimeSettings{}
+	rs.useCORSOrigins(options.CORSOrigins)
+	rs.useRateLimit(options.RateLimit)
+
+	return rs
+}
+
+func (rs *runtimeSettings) useCORSOrigins(origins []string) {
+	rs.corsOrigins.Store(&origins)
+}
+
+func (rs *runtimeSettings) useRateLimit(policy *RateLimitPolicy) {
+	if policy == nil {
+		rs.rateLimit.Store(nil)
+		return
+	}
+
+	updated := *policy
+
+	// keep counting against the current store so that a reload doesn't give every client a fresh quota
+	if current := rs.rateLimit.Load(); current != nil && updated.Store == nil {
+		updated.Store = current.Store
+	}
+
+	updated = updated.withDefaults()
+
+	rs.rateLimit.Store(&updated)
+}
+
+// middleware returns a Middleware that applies the current CORS origins and rate limit
+func (rs *runtimeSettings) middleware() Middleware {
+	return func(inner HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+			if origin := allowedOrigin(*rs.corsOrigins.Load(), r.Header.Get("Origin")); origin != "" {
+				enableCors(ctx, origin)
+
+				if origin != "*" {
+					ctx.RespHeaders.Add("Vary", "Origin")
+				}
+			}
+
+			if policy := rs.rateLimit.Load(); policy != nil {
+				return limitRequest(*policy, inner, w, r, ctx)
+			}
+
+			return inner(w, r, ctx)
+		}
+	}
+}
+
+// preflight returns an http.Handler that answers CORS preflight requests from the current CORS origins, or nil if
+// there are none. It is used for routes without their own OPTIONS handler, which httprouter answers before the
+// middleware runs. Other OPTIONS requests get httprouter's default reply
+func (rs *runtimeSettings) preflight() http.Handler {
+	if len(*rs.corsOrigins.Load()) == 0 {
+		return nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := allowedOrigin(*rs.corsOrigins.Load(), r.Header.Get("Origin"))
+
+		if origin == "" || r.Header.Get("Access-Control-Request-Method") == "" {
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", w.Header().Get("Allow"))
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+
+		if origin != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowedOrigin returns the value of the `Access-Control-Allow-Origin` header for a request from origin,
+// or an empty string if the origin isn't allowed
+func allowedOrigin(allowed []string, origin string) string {
+	for _, a := range allowed {
+		if a == "*" {
+			return "*"
+		}
+
+		if origin != "" && a == origin {
+			return origin
+		}
+	}
+
+	return ""
+}
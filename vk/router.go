@@ -6,6 +6,7 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -34,9 +35,12 @@ type Router struct {
 	*RouteGroup                    // the "root" RouteGroup that is mounted at server start
 	hrouter     *httprouter.Router // the internal 'actual' router
 
-	fallbackProxy *httputil.ReverseProxy
-	quietRoutes   map[string]bool
+	fallbackProxy atomic.Pointer[httputil.ReverseProxy]
+	preflight     atomic.Pointer[http.Handler]
+	quietRoutes   atomic.Pointer[map[string]bool]
 	finalizeOnce  sync.Once // ensure that the root only gets mounted once
+	finalizeErr   error
+	routes        []RouteInfo
 
 	log *vlog.Logger
 }
@@ -45,41 +49,44 @@ type defaultScope struct {
 	RequestID string `json:"request_id"`
 }
 
+// SpanID makes the request the parent of the spans traced while handling it
+func (d defaultScope) SpanID() string {
+	return d.RequestID
+}
+
 // NewRouter creates a new Router
 func NewRouter(logger *vlog.Logger, fallback string) *Router {
-	var proxy *httputil.ReverseProxy
-
-	if fallback != "" {
-		proxyURL, _ := url.Parse(fallback)
-		if proxyURL != nil {
-			proxy = httputil.NewSingleHostReverseProxy(proxyURL)
-		}
-	}
-
 	r := &Router{
-		RouteGroup:    Group(""),
-		hrouter:       httprouter.New(),
-		fallbackProxy: proxy,
-		quietRoutes:   map[string]bool{},
-		finalizeOnce:  sync.Once{},
-		log:           logger,
+		RouteGroup:   Group(""),
+		hrouter:      httprouter.New(),
+		finalizeOnce: sync.Once{},
+		log:          logger,
 	}
 
+	r.useFallback(fallback)
+	r.useQuietRoutes(nil)
+	r.hrouter.GlobalOPTIONS = http.HandlerFunc(r.servePreflight)
+
 	return r
 }
 
 // HandleHTTP handles a classic Go HTTP handlerFunc
 func (rt *Router) HandleHTTP(method, path string, handler http.HandlerFunc) {
+	rt.routes = append(rt.routes, RouteInfo{Method: method, Path: path})
+
 	rt.hrouter.Handle(method, path, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		handler(w, r)
 	})
 }
 
-// Finalize mounts the root group to prepare the Router to handle requests
-func (rt *Router) Finalize() {
+// Finalize mounts the root group to prepare the Router to handle requests. It returns an error if any routes
+// conflict, such as a versioned route's `/v{n}` path and a wildcard route in the same group
+func (rt *Router) Finalize() error {
 	rt.finalizeOnce.Do(func() {
-		rt.mountGroup(rt.RouteGroup)
+		rt.finalizeErr = rt.mountGroup(rt.RouteGroup)
 	})
+
+	return rt.finalizeErr
 }
 
 // ServeHTTP serves HTTP requests
@@ -90,8 +97,8 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if handler != nil {
 		handler(w, r, params)
 	} else {
-		if rt.fallbackProxy != nil {
-			rt.fallbackProxy.ServeHTTP(w, r)
+		if proxy := rt.fallbackProxy.Load(); proxy != nil && !rt.handlesPreflight(r) {
+			proxy.ServeHTTP(w, r)
 			return
 		}
 
@@ -103,11 +110,32 @@ func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // mountGroup adds a group of handlers to the httprouter
-func (rt *Router) mountGroup(group *RouteGroup) {
+func (rt *Router) mountGroup(group *RouteGroup) error {
 	for _, r := range group.httpRouteHandlers() {
 		rt.log.Debug("mounting route", r.Method, r.Path)
-		rt.hrouter.Handle(r.Method, r.Path, rt.httpHandlerWrap(r.Handler))
+
+		if err := rt.mountRoute(r); err != nil {
+			return err
+		}
+
+		rt.routes = append(rt.routes, RouteInfo{Method: r.Method, Path: r.Path})
 	}
+
+	return nil
+}
+
+// mountRoute adds a handler to the httprouter, returning an error rather than
+// panicking if its path conflicts with a route that has already been mounted
+func (rt *Router) mountRoute(r httpRouteHandler) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("failed to mount route %s %s: %v", r.Method, r.Path, recovered)
+		}
+	}()
+
+	rt.hrouter.Handle(r.Method, r.Path, rt.httpHandlerWrap(r.Handler))
+
+	return nil
 }
 
 // httpHandlerWrap returns an httprouter.Handle that uses the `inner` vk.HandleFunc to handle the request
@@ -129,6 +157,7 @@ func (rt *Router) httpHandlerWrap(inner HandlerFunc) httprouter.Handle {
 		// in case a scope was set on it)
 		ctx := NewCtx(rt.log, params, w.Header())
 		ctx.UseScope(defaultScope{ctx.RequestID()})
+		ctx.tlsState = r.TLS
 
 		// There is (should be) an error handling middleware there which should not return an error itself. If there IS
 		// an error here, something went very wrong, and it's a stop the world event.
@@ -148,11 +177,54 @@ func (rt *Router) canHandle(method, path string) bool {
 	return handler != nil
 }
 
-// useQuietRoutes sets the 'quiet' routes for the router's logging
+// useQuietRoutes sets the 'quiet' routes for the router's logging, replacing any previously set
 func (rt *Router) useQuietRoutes(routes []string) {
+	quietRoutes := map[string]bool{}
 	for _, r := range routes {
-		rt.quietRoutes[r] = true
+		quietRoutes[r] = true
 	}
+
+	rt.quietRoutes.Store(&quietRoutes)
+}
+
+// useFallback sets the address that requests without a matching route are proxied to, or disables the proxy if empty
+func (rt *Router) useFallback(fallback string) {
+	var proxy *httputil.ReverseProxy
+
+	if fallback != "" {
+		proxyURL, _ := url.Parse(fallback)
+		if proxyURL != nil {
+			proxy = httputil.NewSingleHostReverseProxy(proxyURL)
+		}
+	}
+
+	rt.fallbackProxy.Store(proxy)
+}
+
+// usePreflight sets the handler for OPTIONS requests to routes without their own OPTIONS handler, which httprouter
+// answers itself without running any middleware. If handler is nil, httprouter's default reply is used
+func (rt *Router) usePreflight(handler http.Handler) {
+	if handler == nil {
+		rt.preflight.Store(nil)
+		return
+	}
+
+	rt.preflight.Store(&handler)
+}
+
+// servePreflight is httprouter's GlobalOPTIONS, which calls the handler set with usePreflight if there is one
+func (rt *Router) servePreflight(w http.ResponseWriter, r *http.Request) {
+	if handler := rt.preflight.Load(); handler != nil {
+		(*handler).ServeHTTP(w, r)
+	}
+}
+
+// handlesPreflight returns true if r is a CORS preflight request for a route the router handles and a preflight
+// handler is set, so that it is answered by the router rather than proxied to the fallback
+func (rt *Router) handlesPreflight(r *http.Request) bool {
+	method := r.Header.Get("Access-Control-Request-Method")
+
+	return r.Method == http.MethodOptions && method != "" && rt.preflight.Load() != nil && rt.canHandle(method, r.URL.Path)
 }
 
 // logRequest logs a request and returns a function
@@ -161,7 +233,7 @@ func (rt *Router) logRequest(r *http.Request, ctx *Ctx) func(int) {
 	start := time.Now()
 
 	logFn := ctx.Log.Info
-	if _, beQuiet := rt.quietRoutes[r.URL.Path]; beQuiet {
+	if _, beQuiet := (*rt.quietRoutes.Load())[r.URL.Path]; beQuiet {
 		logFn = ctx.Log.Debug
 	}
 
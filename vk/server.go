@@ -5,11 +5,15 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	"golang.org/x/crypto/acme/autocert"
+	"github.com/suborbital/vektor/vlog"
 )
 
 const defaultEnvPrefix = "VK_"
@@ -21,8 +25,26 @@ type Server struct {
 	lock           sync.RWMutex
 	started        atomic.Value
 
-	server  *http.Server
-	options *Options
+	listeners     []*serverListener
+	addrs         atomic.Value // []net.Addr, set once the listeners are bound
+	done          chan error   // receives the result of serving once every listener has stopped
+	options       *Options
+	concurrency   *ConcurrencyLimiter
+	runtime       *runtimeSettings
+	adminRouter   *Router
+	adminListener *serverListener
+	startedAt     time.Time
+
+	modifiers  []OptionsModifier // the options are rebuilt from these when the server is reloaded
+	reloadLock sync.Mutex        // serializes reloads, and guards reloaded
+	reloaded   *Options          // options with the changes made by Reload, as options isn't changed after New
+	logLevel   string            // the level the logger was created with, restored if log.level is removed
+	stopReload chan struct{}     // closed when the server is stopped, to stop reloading on SIGHUP
+	stopOnce   sync.Once
+
+	revertLock     sync.Mutex
+	levelReverts   map[string]*levelRevert // log level changes made with a TTL, keyed by logger name
+	revertsStopped bool                    // set when the server is stopped, after which no reverts are scheduled
 }
 
 // New creates a new vektor API server
@@ -31,13 +53,41 @@ func New(opts ...OptionsModifier) *Server {
 
 	internalRouter := NewRouter(options.Logger, options.FallbackAddress)
 	internalRouter.useQuietRoutes(options.QuietRoutes)
+
+	// the first middleware is closest to the handler, so the concurrency limiter runs inside the server's other
+	// middleware, and requests they reject (such as by rate limiting) never wait for a slot
+	var concurrency *ConcurrencyLimiter
+	if options.Concurrency != nil {
+		policy := *options.Concurrency
+		policy.Exempt = append(append([]string{}, policy.Exempt...), options.QuietRoutes...)
+
+		concurrency = NewConcurrencyLimiter(policy)
+		internalRouter.WithMiddlewares(concurrency.Middleware())
+	}
+
+	internalRouter.WithMiddlewares(options.Middleware...)
+
+	runtime := newRuntimeSettings(options)
+	internalRouter.WithMiddlewares(runtime.middleware())
+	internalRouter.usePreflight(runtime.preflight())
+
 	internalRouter.WithMiddlewares(ErrorMiddleware())
 
+	reloaded := *options
+
 	s := &Server{
 		internalRouter: internalRouter,
 		lock:           sync.RWMutex{},
 		started:        atomic.Value{},
 		options:        options,
+		concurrency:    concurrency,
+		runtime:        runtime,
+		modifiers:      opts,
+		reloaded:       &reloaded,
+		logLevel:       options.Logger.Level(),
+		done:           make(chan error, 1),
+		stopReload:     make(chan struct{}),
+		levelReverts:   map[string]*levelRevert{},
 	}
 
 	s.started.Store(false)
@@ -46,13 +96,37 @@ func New(opts ...OptionsModifier) *Server {
 	// but the VK server and HTTP server are
 	// extremely tightly wound together so
 	// we have to make this compromise
-	s.server = createGoServer(options, s)
+	s.listeners = createGoServers(options, s)
+
+	if options.AdminPort != 0 {
+		s.adminRouter = s.newAdminRouter()
+
+		s.adminListener = &serverListener{
+			name:    "admin",
+			server:  newGoServer(options, adminTCPAddr(options), s.adminRouter),
+			network: "tcp",
+			addr:    adminTCPAddr(options),
+		}
+
+		s.listeners = append(s.listeners, s.adminListener)
+	}
 
 	return s
 }
 
-// Start starts the server listening
+// Start starts the server listening, blocking until the server is stopped
 func (s *Server) Start() error {
+	if err := s.StartAsync(); err != nil {
+		return err
+	}
+
+	return <-s.done
+}
+
+// StartAsync starts the server listening, returning once every listener is bound (or any
+// fails to bind) while serving continues in the background. Errors that occur while serving are
+// logged, and Addr can be used to discover the address the server is listening on
+func (s *Server) StartAsync() error {
 	if s.started.Load().(bool) {
 		err := errors.New("server already started")
 		s.options.Logger.Error(err)
@@ -63,23 +137,104 @@ func (s *Server) Start() error {
 	s.started.Store(true)
 
 	// mount the root set of routes before starting
-	s.internalRouter.Finalize()
+	if err := s.internalRouter.Finalize(); err != nil {
+		s.options.Logger.Error(err)
+		return err
+	}
+
+	if s.adminRouter != nil {
+		if err := s.adminRouter.Finalize(); err != nil {
+			s.options.Logger.Error(err)
+			return err
+		}
+	}
 
 	s.router = s.options.RouterWrapper(s.internalRouter)
+	s.startedAt = time.Now()
 
 	if s.options.AppName != "" {
 		s.options.Logger.Info("starting", s.options.AppName, "...")
 	}
 
-	s.options.Logger.Debug("serving on", s.server.Addr)
-
-	if !s.options.HTTPPortSet() && !s.options.ShouldUseTLS() {
+	if !s.options.HTTPPortSet() && !s.options.ShouldUseTLS() && !s.options.hasExtraListeners() {
 		s.options.Logger.ErrorString("domain and HTTP port options are both unset, server will start up but fail to acquire a certificate. reconfigure and restart")
-	} else if s.options.ShouldUseHTTP() {
-		return s.server.ListenAndServe()
 	}
 
-	return s.server.ListenAndServeTLS("", "")
+	// bind every listener before serving any of them, so that
+	// a bad address doesn't leave the server half-started
+	addrs := make([]net.Addr, len(s.listeners))
+
+	for i, sl := range s.listeners {
+		if err := sl.bind(); err != nil {
+			for _, bound := range s.listeners[:i] {
+				bound.listener.Close()
+			}
+
+			s.options.Logger.Error(err)
+			return err
+		}
+
+		addrs[i] = sl.listener.Addr()
+	}
+
+	s.addrs.Store(addrs)
+
+	if s.options.ReloadOnSIGHUP {
+		s.reloadOnSIGHUP()
+	}
+
+	errs := make(chan error, len(s.listeners))
+
+	for _, sl := range s.listeners {
+		s.options.Logger.Debug("serving", sl.name, "on", sl.listener.Addr().String())
+
+		go func(sl *serverListener) {
+			errs <- sl.serve()
+		}(sl)
+	}
+
+	go func() {
+		// wait for every listener to stop, reporting the first unexpected error
+		// (which causes the rest to be shut down) or ErrServerClosed if they all closed cleanly
+		var firstErr error
+
+		for range s.listeners {
+			if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) && firstErr == nil {
+				firstErr = err
+
+				s.options.Logger.Error(err)
+
+				go shutdownServers(context.Background(), s.listeners)
+			}
+		}
+
+		if firstErr == nil {
+			firstErr = http.ErrServerClosed
+		}
+
+		s.done <- firstErr
+	}()
+
+	return nil
+}
+
+// Addr returns the address of the server's primary listener (the TLS port if TLS is configured, otherwise the HTTP
+// port, Unix socket or provided listener), or nil if the server hasn't been started. This is useful to discover the
+// port chosen by the OS when EphemeralPort is used
+func (s *Server) Addr() net.Addr {
+	addrs := s.Addrs()
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	return addrs[0]
+}
+
+// Addrs returns the addresses of all of the server's listeners, or nil if the server hasn't been started
+func (s *Server) Addrs() []net.Addr {
+	addrs, _ := s.addrs.Load().([]net.Addr)
+
+	return addrs
 }
 
 // Stop shuts down the server and returns any associated errors
@@ -89,7 +244,20 @@ func (s *Server) Stop() error {
 
 // StopCtx shuts down the server (with a context) and returns any associated errors
 func (s *Server) StopCtx(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	s.stopOnce.Do(func() {
+		close(s.stopReload)
+	})
+
+	s.stopLogLevelReverts()
+
+	err := shutdownServers(ctx, s.listeners)
+
+	// write anything an async logger has buffered, the logger is left open as it may be shared
+	if flushErr := s.options.Logger.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+
+	return err
 }
 
 // TestStart "starts" the server for automated testing with vtest
@@ -104,7 +272,10 @@ func (s *Server) TestStart() error {
 	s.started.Store(true)
 
 	// mount the root set of routes before starting
-	s.internalRouter.Finalize()
+	if err := s.internalRouter.Finalize(); err != nil {
+		s.options.Logger.Error(err)
+		return err
+	}
 
 	if s.options.AppName != "" {
 		s.options.Logger.Debug("starting", s.options.AppName, "in Test Mode...")
@@ -134,11 +305,30 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
 
+// ConcurrencyStats returns the state of the server-wide concurrency limit, or
+// false if the server was not configured with UseConcurrencyLimit
+func (s *Server) ConcurrencyStats() (ConcurrencyStats, bool) {
+	if s.concurrency == nil {
+		return ConcurrencyStats{}, false
+	}
+
+	return s.concurrency.Stats(), true
+}
+
 // SwapRouter allows swapping VK's router out in realtime while
-// continuing to serve requests in the background
+// continuing to serve requests in the background. If the new router
+// fails to finalize, the error is logged and the current router is kept
 func (s *Server) SwapRouter(router *Router) {
-	router.Finalize()
-	router.useQuietRoutes(s.options.QuietRoutes)
+	if err := router.Finalize(); err != nil {
+		// keep serving with the current router rather than one with missing routes
+		s.options.Logger.Error(fmt.Errorf("failed to swap router: %w", err))
+		return
+	}
+
+	s.reloadLock.Lock()
+	router.useQuietRoutes(s.reloaded.QuietRoutes)
+	router.usePreflight(s.runtime.preflight())
+	s.reloadLock.Unlock()
 
 	// lock after Finalizing the router so
 	// the lock is released as quickly as possible
@@ -256,63 +446,154 @@ func (s *Server) HandleHTTP(method, path string, handler http.HandlerFunc) {
 	s.internalRouter.HandleHTTP(method, path, handler)
 }
 
-func createGoServer(options *Options, handler http.Handler) *http.Server {
+// createGoServers creates the listeners the server will serve, each backed by an http.Server that uses handler
+func createGoServers(options *Options, handler http.Handler) []*serverListener {
+	extras := extraListeners(options, handler)
+
+	if !options.HTTPPortSet() && !options.ShouldUseTLS() && len(extras) > 0 {
+		options.Logger.Debug("configured to use HTTP with no TLS on provided listeners only")
+		return extras
+	}
+
 	if useHTTP := options.ShouldUseHTTP(); useHTTP {
-		return goHTTPServerWithPort(options, handler)
+		return append([]*serverListener{goHTTPServerWithPort(options, handler)}, extras...)
 	}
 
-	return goTLSServerWithDomain(options, handler)
+	return append(goTLSServerWithDomain(options, handler), extras...)
 }
 
-func goTLSServerWithDomain(options *Options, handler http.Handler) *http.Server {
-	if options.TLSConfig != nil {
+func goTLSServerWithDomain(options *Options, handler http.Handler) []*serverListener {
+	if options.TLSCertFile != "" {
+		options.Logger.Info("configured for HTTPS using certificate file", options.TLSCertFile)
+	} else if options.TLSConfig != nil {
 		options.Logger.Info("configured for HTTPS with custom configuration")
-	} else if options.Domain != "" {
-		options.Logger.Info("configured for HTTPS using domain", options.Domain)
+	} else if domains := options.autocertDomains(); len(domains) > 0 {
+		options.Logger.Info("configured for HTTPS using domains", strings.Join(domains, ", "))
+	}
+
+	tlsPort := options.TLSPort
+	if tlsPort == 0 {
+		tlsPort = 443
+	}
+
+	s := newGoServer(options, tcpAddr(options, tlsPort), handler)
+
+	tlsListener := &serverListener{
+		name:    "HTTPS",
+		server:  s,
+		network: "tcp",
+		addr:    s.Addr,
+		useTLS:  true,
+	}
+
+	// determine what (if anything) should be served over plain HTTP alongside HTTPS
+	var httpHandler http.Handler
+	if options.ServeHTTPWithTLS {
+		httpHandler = plainHandler(options, handler)
+	} else if options.RedirectHTTP {
+		httpHandler = httpsRedirectHandler(tlsListener)
+	}
+
+	httpPort := options.HTTPPort
+	if httpPort == 0 {
+		httpPort = 8080
 	}
 
 	tlsConfig := options.TLSConfig
 
-	if tlsConfig == nil {
-		m := &autocert.Manager{
-			Cache:      autocert.DirCache("~/.autocert"),
-			Prompt:     autocert.AcceptTOS,
-			HostPolicy: autocert.HostWhitelist(options.Domain),
-		}
+	if options.TLSCertFile != "" {
+		tlsListener.certs = newCertReloader(options.TLSCertFile, options.TLSKeyFile, options.TLSCertReloadInterval, options.Logger)
 
-		addr := fmt.Sprintf(":%d", options.HTTPPort)
-		if options.HTTPPort == 0 {
-			addr = ":8080"
+		// any custom TLS configuration is kept, but the certificate always comes from the files
+		if tlsConfig != nil {
+			tlsConfig = tlsConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{}
 		}
 
-		options.Logger.Info("serving TLS challenges on", addr)
+		tlsConfig.Certificates = nil
+		tlsConfig.GetCertificate = tlsListener.certs.GetCertificate
+	} else if tlsConfig == nil {
+		m := newAutocertManager(options)
+
+		options.Logger.Info("serving TLS challenges on", tcpAddr(options, httpPort))
 
-		go http.ListenAndServe(addr, m.HTTPHandler(nil))
+		// the autocert handler falls back to redirecting to HTTPS if httpHandler is nil
+		httpHandler = m.HTTPHandler(httpHandler)
 
 		tlsConfig = &tls.Config{GetCertificate: m.GetCertificate}
 	}
 
-	addr := fmt.Sprintf(":%d", options.TLSPort)
-	if options.TLSPort == 0 {
-		addr = ":443"
+	s.TLSConfig = configureClientAuth(options, tlsConfig)
+	configureHTTP2(options, s)
+
+	// the TLS listener comes first, as it is the primary listener
+	listeners := []*serverListener{tlsListener}
+
+	if httpHandler != nil {
+		listeners = append(listeners, &serverListener{
+			name:    "HTTP",
+			server:  newGoServer(options, tcpAddr(options, httpPort), httpHandler),
+			network: "tcp",
+			addr:    tcpAddr(options, httpPort),
+		})
 	}
 
-	s := &http.Server{
-		Addr:      addr,
-		TLSConfig: tlsConfig,
-		Handler:   handler,
+	return listeners
+}
+
+func goHTTPServerWithPort(options *Options, handler http.Handler) *serverListener {
+	if options.H2C {
+		options.Logger.Debug("configured to use HTTP with no TLS, including HTTP/2 cleartext (h2c)")
+	} else {
+		options.Logger.Debug("configured to use HTTP with no TLS")
 	}
 
-	return s
+	s := newGoServer(options, tcpAddr(options, options.HTTPPort), plainHandler(options, handler))
+
+	sl := &serverListener{
+		name:    "HTTP",
+		server:  s,
+		network: "tcp",
+		addr:    s.Addr,
+	}
+
+	return sl
 }
 
-func goHTTPServerWithPort(options *Options, handler http.Handler) *http.Server {
-	options.Logger.Debug("configured to use HTTP with no TLS")
+// newGoServer creates an http.Server configured with the tuning options common to all serving modes
+func newGoServer(options *Options, addr string, handler http.Handler) *http.Server {
+	errorLog := options.ServerErrorLog
+	if errorLog == nil {
+		errorLog = log.New(&serverErrorWriter{options.Logger}, "", 0)
+	}
 
 	s := &http.Server{
-		Addr:    fmt.Sprintf(":%d", options.HTTPPort),
-		Handler: handler,
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       options.ReadTimeout,
+		ReadHeaderTimeout: options.ReadHeaderTimeout,
+		WriteTimeout:      options.WriteTimeout,
+		IdleTimeout:       options.IdleTimeout,
+		MaxHeaderBytes:    options.MaxHeaderBytes,
+		ErrorLog:          errorLog,
+		ConnState:         options.ConnState,
+		BaseContext:       options.BaseContext,
 	}
 
+	s.SetKeepAlivesEnabled(!options.DisableKeepAlives)
+
 	return s
 }
+
+// serverErrorWriter routes the http.Server's error log into a vlog.Logger
+type serverErrorWriter struct {
+	logger *vlog.Logger
+}
+
+// Write implements io.Writer
+func (s *serverErrorWriter) Write(p []byte) (int, error) {
+	s.logger.ErrorString("[http]", strings.TrimSpace(string(p)))
+
+	return len(p), nil
+}
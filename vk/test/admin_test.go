@@ -0,0 +1,259 @@
+package test_test
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestAdminServer(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseAdminServer(vk.EphemeralPort),
+	)
+
+	server.GET("/hello", handleOK)
+
+	server.AdminRouter().GET("/custom", handleOK)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	admin := "http://" + server.AdminAddr().String()
+
+	// operational endpoints are only served on the admin port
+	if status, _ := get(t, "http://"+server.Addr().String()+"/health"); status != http.StatusNotFound {
+		t.Errorf("got status %d for /health on the main listener", status)
+	}
+
+	if status, _ := get(t, admin+"/health"); status != http.StatusOK {
+		t.Errorf("got status %d for /health", status)
+	}
+
+	if status, _ := get(t, admin+"/custom"); status != http.StatusOK {
+		t.Errorf("got status %d for a custom admin route", status)
+	}
+
+	_, body := get(t, admin+"/routes")
+
+	routes := []vk.RouteInfo{}
+	if err := json.Unmarshal([]byte(body), &routes); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 1 || routes[0] != (vk.RouteInfo{Method: http.MethodGet, Path: "/hello"}) {
+		t.Errorf("got routes %v", routes)
+	}
+
+	if _, body := get(t, admin+"/metrics"); !strings.Contains(body, "vk_uptime_seconds") {
+		t.Errorf("got metrics %q", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, admin+"/loglevel?level=error", nil)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	if _, body := get(t, admin+"/loglevel"); body != `{"level":"error"}` {
+		t.Errorf("got log level %s", body)
+	}
+
+	// pprof is only served if enabled
+	if status, _ := get(t, admin+"/debug/pprof/cmdline"); status != http.StatusNotFound {
+		t.Errorf("got status %d for pprof", status)
+	}
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseAdminServer(vk.EphemeralPort),
+		vk.UseAdminEndpoints(vk.AdminPprof),
+	)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	admin := "http://" + server.AdminAddr().String()
+
+	if status, _ := get(t, admin+"/debug/pprof/cmdline"); status != http.StatusOK {
+		t.Errorf("got status %d for pprof", status)
+	}
+
+	if status, _ := get(t, admin+"/health"); status != http.StatusNotFound {
+		t.Errorf("got status %d for disabled /health", status)
+	}
+}
+
+func TestAdminLogLevelTTL(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseAdminServer(vk.EphemeralPort),
+	)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	admin := "http://" + server.AdminAddr().String()
+
+	if status := do(t, http.MethodPut, admin+"/loglevel?level=error&ttl=100ms"); status != http.StatusOK {
+		t.Errorf("got status %d", status)
+	}
+
+	if status := do(t, http.MethodPut, admin+"/loglevel?level=trace&logger=store&ttl=100ms"); status != http.StatusOK {
+		t.Errorf("got status %d", status)
+	}
+
+	if _, body := get(t, admin+"/loglevel"); body != `{"level":"error","loggers":{"store":"trace"}}` {
+		t.Errorf("got log levels %s", body)
+	}
+
+	// both revert to their level before the changes
+	waitFor(t, func() bool {
+		_, body := get(t, admin+"/loglevel")
+		return body == `{"level":"null"}`
+	})
+
+	// a change without a TTL cancels a pending revert
+	do(t, http.MethodPut, admin+"/loglevel?level=warn&ttl=50ms")
+	do(t, http.MethodPut, admin+"/loglevel?level=error")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if logger.Level() != vlog.LogLevelError {
+		t.Errorf("got level %s after the cancelled revert", logger.Level())
+	}
+
+	do(t, http.MethodPut, admin+"/loglevel?level=debug&logger=store")
+
+	if status := do(t, http.MethodDelete, admin+"/loglevel?logger=store"); status != http.StatusOK || len(logger.NamedLevels()) != 0 {
+		t.Errorf("got status %d and levels %v after delete", status, logger.NamedLevels())
+	}
+
+	if status := do(t, http.MethodPut, admin+"/loglevel?level=debug&ttl=soon"); status != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid ttl", status)
+	}
+
+	// stopping the server cancels pending reverts
+	do(t, http.MethodPut, admin+"/loglevel?level=debug&ttl=50ms")
+
+	server.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if logger.Level() != vlog.LogLevelDebug {
+		t.Errorf("got level %s, a revert fired after the server stopped", logger.Level())
+	}
+}
+
+func do(t *testing.T, method, url string) int {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, url, nil)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, string(body)
+}
+
+func TestAdminBindAddress(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	// the public listener is on every interface, but the admin server stays on the loopback interface
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseAdminServer(vk.EphemeralPort),
+	)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	if addr := server.AdminAddr().(*net.TCPAddr); !addr.IP.IsLoopback() {
+		t.Errorf("got admin address %s, want a loopback address", addr)
+	}
+
+	if addr := server.Addr().(*net.TCPAddr); !addr.IP.IsUnspecified() {
+		t.Errorf("got address %s, want every interface", addr)
+	}
+
+	server = vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseAdminServer(vk.EphemeralPort),
+		vk.UseAdminBindAddress("0.0.0.0"),
+	)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	if addr := server.AdminAddr().(*net.TCPAddr); !addr.IP.IsUnspecified() {
+		t.Errorf("got admin address %s, want every interface", addr)
+	}
+}
@@ -0,0 +1,98 @@
+package test_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vk/test"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestAutocertCache(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	pair, err := test.GenerateCert(nil, test.CertOptions{CommonName: "example.test", DNSNames: []string{"example.test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// certificates found in the cache are served without contacting the ACME server
+	cache := &memoryCache{data: map[string][]byte{
+		"example.test": bytes.Join([][]byte{pair.KeyPEM, pair.CertPEM}, nil),
+	}}
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseTLSPort(vk.EphemeralPort),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseDomains("example.test", "other.test"),
+		vk.UseAutocertCache(cache),
+		vk.UseACMEDirectory("http://127.0.0.1:1/directory"),
+	)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	conn, err := tls.Dial("tcp", server.Addr().String(), &tls.Config{ServerName: "example.test", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	if serial := conn.ConnectionState().PeerCertificates[0].SerialNumber; serial.Cmp(pair.Cert.SerialNumber) != 0 {
+		t.Errorf("got serial %s, want %s", serial, pair.Cert.SerialNumber)
+	}
+
+	// domains that aren't configured are rejected
+	if conn, err := tls.Dial("tcp", server.Addr().String(), &tls.Config{ServerName: "unknown.test", InsecureSkipVerify: true}); err == nil {
+		conn.Close()
+		t.Error("expected handshake for an unconfigured domain to fail")
+	}
+}
+
+type memoryCache struct {
+	lock sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	data, ok := m.data[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return data, nil
+}
+
+func (m *memoryCache) Put(_ context.Context, key string, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.data[key] = data
+
+	return nil
+}
+
+func (m *memoryCache) Delete(_ context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.data, key)
+
+	return nil
+}
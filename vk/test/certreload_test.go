@@ -0,0 +1,101 @@
+package test_test
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vk/test"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestTLSCertFileReload(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	first := writeKeyPair(t, certFile, keyFile, "first")
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseTLSPort(vk.EphemeralPort),
+		vk.UseTLSCertFiles(certFile, keyFile),
+		vk.UseTLSCertReloadInterval(10*time.Millisecond),
+	)
+
+	server.GET("/hello", handleOK)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	addr := server.Addr().String()
+
+	if serial := servedSerial(t, addr); serial != first.Cert.SerialNumber.String() {
+		t.Fatalf("got serial %s, want %s", serial, first.Cert.SerialNumber)
+	}
+
+	second := writeKeyPair(t, certFile, keyFile, "second")
+
+	waitFor(t, func() bool {
+		return servedSerial(t, addr) == second.Cert.SerialNumber.String()
+	})
+
+	// an invalid pair (the new cert with the old key) is rejected and the previous certificate kept
+	third, err := test.GenerateCert(nil, test.CertOptions{CommonName: "third"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, third.CertPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if serial := servedSerial(t, addr); serial != second.Cert.SerialNumber.String() {
+		t.Errorf("got serial %s after invalid rotation, want %s", serial, second.Cert.SerialNumber)
+	}
+}
+
+// writeKeyPair generates a self-signed certificate and writes it to the provided files
+func writeKeyPair(t *testing.T, certFile, keyFile, name string) *test.CertKeyPair {
+	t.Helper()
+
+	pair, err := test.GenerateCert(nil, test.CertOptions{CommonName: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pair.KeyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pair.CertPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return pair
+}
+
+// servedSerial returns the serial number of the certificate served at addr
+func servedSerial(t *testing.T, addr string) string {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+}
@@ -0,0 +1,236 @@
+package test_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+	"github.com/suborbital/vektor/vtest"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseQuietRoutes("/health"),
+		vk.UseConcurrencyLimit(vk.ConcurrencyPolicy{
+			MaxInFlight: 1,
+			MaxQueue:    1,
+			MaxWait:     time.Second,
+			RetryAfter:  2 * time.Second,
+		}),
+	)
+
+	release := make(chan struct{})
+	entered := make(chan struct{}, 2)
+
+	server.GET("/slow", func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		entered <- struct{}{}
+		<-release
+
+		return vk.RespondString(ctx.Context, w, "done", http.StatusOK)
+	})
+
+	server.GET("/health", handleOK)
+
+	vt := vtest.New(server)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		server.ServeHTTP(w, r)
+
+		return w
+	}
+
+	wg := sync.WaitGroup{}
+	results := make([]*httptest.ResponseRecorder, 2)
+
+	// the first request takes the only slot
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0] = serve("/slow")
+	}()
+
+	<-entered
+
+	// the second request waits in the queue
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[1] = serve("/slow")
+	}()
+
+	waitFor(t, func() bool {
+		stats, _ := server.ConcurrencyStats()
+		return stats.Queued == 1
+	})
+
+	t.Run("shed", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/slow", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusServiceUnavailable).
+			AssertHeader("Retry-After", "2")
+	})
+
+	t.Run("exempt quiet route", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/health", nil)
+
+		vt.Do(r, t).AssertStatus(http.StatusOK)
+	})
+
+	close(release)
+	wg.Wait()
+
+	for i, res := range results {
+		if res.Code != http.StatusOK {
+			t.Errorf("request %d: got status %d, want 200", i, res.Code)
+		}
+	}
+
+	stats, _ := server.ConcurrencyStats()
+	if stats.InFlight != 0 || stats.Queued != 0 || stats.Shed != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	limiter := vk.NewConcurrencyLimiter(vk.ConcurrencyPolicy{
+		MaxInFlight: 1,
+		MaxQueue:    5,
+		MaxWait:     10 * time.Millisecond,
+	})
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+
+	slow := vk.WrapHandler(func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		close(entered)
+		<-release
+		return nil
+	}, limiter.Middleware())
+
+	go slow(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), vk.NewCtx(nil, nil, http.Header{}))
+
+	<-entered
+
+	err := slow(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), vk.NewCtx(nil, nil, http.Header{}))
+
+	close(release)
+
+	if vkErr, ok := err.(vk.Error); !ok || vkErr.Status() != http.StatusServiceUnavailable {
+		t.Errorf("got %v, want 503 vk.Error", err)
+	}
+}
+
+func TestConcurrencyLimitUnlimited(t *testing.T) {
+	limiter := vk.NewConcurrencyLimiter(vk.ConcurrencyPolicy{})
+
+	handler := vk.WrapHandler(func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		stats, limited := ctx.ConcurrencyStats()
+		if !limited || stats.InFlight != 1 || stats.Queued != 0 {
+			t.Errorf("unexpected stats from Ctx: %+v, %v", stats, limited)
+		}
+
+		return nil
+	}, limiter.Middleware())
+
+	if err := handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), vk.NewCtx(nil, nil, http.Header{})); err != nil {
+		t.Errorf("expected a MaxInFlight of 0 to be unlimited, got %v", err)
+	}
+
+	if stats := limiter.Stats(); stats.InFlight != 0 || stats.Shed != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// waitFor polls cond until it returns true or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimitWithRateLimitAndCORS(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseCORSOrigins("https://a.example"),
+		vk.UseRateLimit(vk.RateLimitPolicy{Limit: 1, Window: time.Minute}),
+		vk.UseConcurrencyLimit(vk.ConcurrencyPolicy{MaxInFlight: 1, MaxWait: time.Second}),
+	)
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+
+	server.GET("/slow", func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		close(entered)
+		<-release
+
+		return vk.RespondString(ctx.Context, w, "done", http.StatusOK)
+	})
+
+	if err := server.TestStart(); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/slow", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Origin", "https://a.example")
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		return w
+	}
+
+	done := make(chan struct{})
+
+	// the first request takes the only slot
+	go func() {
+		defer close(done)
+		serve("192.0.2.1:1000")
+	}()
+
+	<-entered
+
+	defer func() {
+		close(release)
+		<-done
+	}()
+
+	// the same client is rate limited straight away rather than waiting for a slot
+	start := time.Now()
+
+	if w := serve("192.0.2.1:1001"); w.Code != http.StatusTooManyRequests || w.Header().Get("Access-Control-Allow-Origin") != "https://a.example" {
+		t.Errorf("got status %d, allowed origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("rate limited request waited %s", elapsed)
+	}
+
+	// another client is shed, and browsers can read the 503
+	if w := serve("192.0.2.2:1000"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Access-Control-Allow-Origin") != "https://a.example" {
+		t.Errorf("got status %d, allowed origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -0,0 +1,75 @@
+package test_test
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestH2C(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseH2C(),
+		vk.UseHTTP2Settings(vk.HTTP2Settings{MaxConcurrentStreams: 10}),
+	)
+
+	server.GET("/proto", func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		return vk.RespondString(ctx.Context, w, r.Proto, http.StatusOK)
+	})
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	// a client speaking HTTP/2 with prior knowledge over a plain TCP connection
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+
+	res, err := client.Get("http://" + server.Addr().String() + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	if res.ProtoMajor != 2 {
+		t.Errorf("got protocol %s, want HTTP/2", res.Proto)
+	}
+
+	// plain HTTP/1.1 clients continue to work
+	assertProto(t, http.DefaultClient, "http://"+server.Addr().String()+"/proto", "HTTP/1.1")
+}
+
+func assertProto(t *testing.T, client *http.Client, url, proto string) {
+	t.Helper()
+
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	if res.Proto != proto {
+		t.Errorf("got protocol %s, want %s", res.Proto, proto)
+	}
+}
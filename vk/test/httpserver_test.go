@@ -0,0 +1,157 @@
+package test_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestServerErrorLog(t *testing.T) {
+	output := &lockedBuffer{}
+	logger := vlog.Default(vlog.WithWriter(output), vlog.ConsoleMirror(false), vlog.Level(vlog.LogLevelError))
+
+	addr := startTestServer(t, func(server *vk.Server) {
+		server.HandleHTTP(http.MethodGet, "/panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("handler exploded")
+		})
+	}, vk.UseLogger(logger))
+
+	if res, err := http.Get("http://" + addr + "/panic"); err == nil {
+		res.Body.Close()
+	}
+
+	waitFor(t, func() bool {
+		return strings.Contains(output.String(), "[http] http: panic serving")
+	})
+
+	if !strings.Contains(output.String(), "handler exploded") {
+		t.Errorf("expected the panic to be logged through vlog, got %q", output.String())
+	}
+}
+
+func TestServerHeaderLimits(t *testing.T) {
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	addr := startTestServer(t, routeHello,
+		vk.UseLogger(logger),
+		vk.UseReadHeaderTimeout(50*time.Millisecond),
+		vk.UseMaxHeaderBytes(1024),
+	)
+
+	t.Run("max header bytes", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/hello", nil)
+		req.Header.Set("X-Large", strings.Repeat("a", 8*1024))
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+			t.Errorf("got status %d, want 431", res.StatusCode)
+		}
+	})
+
+	t.Run("read header timeout", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		// never finish sending the headers
+		if _, err := conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: vk.test\r\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		// the server closes the connection once the timeout passes
+		buf := make([]byte, 1024)
+		for err == nil {
+			_, err = conn.Read(buf)
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Error("expected the server to close the connection after the header timeout")
+		}
+	})
+}
+
+func TestServerKeepAlives(t *testing.T) {
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	for _, enabled := range []bool{true, false} {
+		addr := startTestServer(t, routeHello, vk.UseLogger(logger), vk.UseKeepAlives(enabled))
+
+		res, err := http.Get("http://" + addr + "/hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+
+		if res.Close == enabled {
+			t.Errorf("keep-alives enabled %v: got Connection: close %v", enabled, res.Close)
+		}
+	}
+}
+
+// startTestServer starts a server on an ephemeral port after adding its routes, returning its address
+func startTestServer(t *testing.T, routes func(*vk.Server), opts ...vk.OptionsModifier) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := vk.New(append(opts, vk.UseListener(listener))...)
+	routes(server)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		server.Stop()
+	})
+
+	return listener.Addr().String()
+}
+
+func routeHello(server *vk.Server) {
+	server.GET("/hello", handleOK)
+}
+
+// lockedBuffer is a bytes.Buffer that can be written by a logger while a test reads it
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (l *lockedBuffer) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.buf.Write(p)
+}
+
+func (l *lockedBuffer) String() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.buf.String()
+}
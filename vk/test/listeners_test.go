@@ -0,0 +1,177 @@
+package test_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestListeners(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "vk.sock")
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseListener(tcpListener),
+		vk.UseUnixSocket(socketPath),
+	)
+
+	server.GET("/hello", handleOK)
+
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- server.Start()
+	}()
+
+	waitFor(t, func() bool {
+		return server.Addr() != nil
+	})
+
+	if server.Addr().String() != tcpListener.Addr().String() {
+		t.Errorf("got Addr %s, want %s", server.Addr(), tcpListener.Addr())
+	}
+
+	t.Run("pre-opened listener", func(t *testing.T) {
+		assertGetOK(t, http.DefaultClient, "http://"+tcpListener.Addr().String()+"/hello")
+	})
+
+	t.Run("unix socket", func(t *testing.T) {
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+				},
+			},
+		}
+
+		assertGetOK(t, client, "http://unix/hello")
+	})
+
+	if err := server.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-startErr; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("got Start error %v, want http.ErrServerClosed", err)
+	}
+}
+
+func TestHTTPRedirect(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	tlsConfig := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return nil, errors.New("no certificate")
+		},
+	}
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseTLSConfig(tlsConfig),
+		vk.UseHTTPPort(vk.EphemeralPort),
+		vk.UseTLSPort(vk.EphemeralPort),
+		vk.UseHTTPRedirect(),
+	)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	addrs := server.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("got %d addresses, want 2", len(addrs))
+	}
+
+	tlsAddr, httpAddr := addrs[0].String(), addrs[1].String()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get("http://" + httpAddr + "/hello?a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("got status %d, want 301", res.StatusCode)
+	}
+
+	if want := "https://" + tlsAddr + "/hello?a=b"; res.Header.Get("Location") != want {
+		t.Errorf("got Location %s, want %s", res.Header.Get("Location"), want)
+	}
+}
+
+func assertGetOK(t *testing.T, client *http.Client, url string) {
+	t.Helper()
+
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+
+	if res.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %d %q, want 200 \"ok\"", res.StatusCode, string(body))
+	}
+}
+
+func TestEphemeralPort(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseHTTPPort(vk.EphemeralPort),
+	)
+
+	server.GET("/hello", handleOK)
+
+	if server.Addr() != nil {
+		t.Error("expected nil Addr before starting")
+	}
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	addr, ok := server.Addr().(*net.TCPAddr)
+	if !ok || addr.Port == 0 {
+		t.Fatalf("unexpected Addr %v", server.Addr())
+	}
+
+	assertGetOK(t, http.DefaultClient, "http://"+addr.String()+"/hello")
+
+	if err := server.StartAsync(); err == nil {
+		t.Error("expected error starting twice")
+	}
+}
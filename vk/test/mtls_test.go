@@ -0,0 +1,125 @@
+package test_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vk/test"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestMutualTLS(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	ca, err := test.GenerateCert(nil, test.CertOptions{CommonName: "test CA", IsCA: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverCert, err := test.GenerateCert(nil, test.CertOptions{CommonName: "server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod := clientCert(t, ca, "spiffe://example.org/ns/prod/sa/api")
+	staging := clientCert(t, ca, "spiffe://example.org/ns/staging/sa/api")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Cert)
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseBindAddress("127.0.0.1"),
+		vk.UseTLSPort(vk.EphemeralPort),
+		vk.UseTLSConfig(&tls.Config{Certificates: []tls.Certificate{tlsCert(serverCert)}}),
+		vk.UseClientCAs(clientCAs),
+		vk.UseClientAuth(tls.VerifyClientCertIfGiven),
+	)
+
+	api := vk.Group("/api")
+
+	api.GET("/whoami", func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		return vk.RespondString(ctx.Context, w, ctx.ClientIdentity().SPIFFEID, http.StatusOK)
+	}, vk.AuthorizeClient("spiffe://example.org/ns/prod/sa/*"))
+
+	server.AddGroup(api)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(serverCert.Cert)
+
+	tests := []struct {
+		name   string
+		certs  []tls.Certificate
+		status int
+		body   string
+	}{
+		{"authorized identity", []tls.Certificate{tlsCert(prod)}, http.StatusOK, "spiffe://example.org/ns/prod/sa/api"},
+		{"no client certificate", nil, http.StatusUnauthorized, ""},
+		{"unauthorized identity", []tls.Certificate{tlsCert(staging)}, http.StatusForbidden, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{RootCAs: serverCAs, Certificates: tc.certs},
+				},
+			}
+
+			res, err := client.Get("https://" + server.Addr().String() + "/api/whoami")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer res.Body.Close()
+
+			if res.StatusCode != tc.status {
+				t.Errorf("got status %d, want %d", res.StatusCode, tc.status)
+			}
+
+			if tc.body != "" {
+				body, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(body) != tc.body {
+					t.Errorf("got body %q, want %q", body, tc.body)
+				}
+			}
+		})
+	}
+}
+
+// clientCert generates a client certificate signed by ca with the provided URI SAN
+func clientCert(t *testing.T, ca *test.CertKeyPair, uri string) *test.CertKeyPair {
+	t.Helper()
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := test.GenerateCert(ca, test.CertOptions{CommonName: "client", URIs: []*url.URL{parsed}, Client: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pair
+}
+
+func tlsCert(pair *test.CertKeyPair) tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{pair.Cert.Raw}, PrivateKey: pair.Key, Leaf: pair.Cert}
+}
@@ -0,0 +1,115 @@
+package test_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+	"github.com/suborbital/vektor/vtest"
+)
+
+func TestParamConstraints(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelError))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+	)
+
+	users := vk.Group("/users")
+
+	users.GET("/:id", func(w http.ResponseWriter, r *http.Request, c *vk.Ctx) error {
+		id, err := c.ParamInt("id")
+		if err != nil {
+			return err
+		}
+
+		return vk.RespondString(c.Context, w, fmt.Sprintf("user %d", id), http.StatusOK)
+	}, vk.ConstrainParam("id", vk.IsInt()))
+
+	users.GET("/:id/role/:role", func(w http.ResponseWriter, r *http.Request, c *vk.Ctx) error {
+		return vk.RespondString(c.Context, w, c.Param("role"), http.StatusOK)
+	}, vk.ValidateParam("role", vk.IsOneOf("admin", "member")))
+
+	server.AddGroup(users)
+
+	server.GET("/things/:uuid", func(w http.ResponseWriter, r *http.Request, c *vk.Ctx) error {
+		id, err := c.ParamUUID("uuid")
+		if err != nil {
+			return err
+		}
+
+		return vk.RespondString(c.Context, w, id.String(), http.StatusOK)
+	})
+
+	vt := vtest.New(server)
+
+	t.Run("int", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/users/42", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("user 42")
+	})
+
+	t.Run("int mismatch", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/users/abc", nil)
+
+		expect, _ := json.Marshal(vk.E(http.StatusNotFound, "Not Found"))
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusNotFound).
+			AssertBody(expect)
+	})
+
+	t.Run("enum", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/users/42/role/admin", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("admin")
+	})
+
+	t.Run("enum mismatch", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/users/42/role/owner", nil)
+
+		expect, _ := json.Marshal(vk.E(http.StatusBadRequest, `invalid path parameter role: "owner" is not one of [admin, member]`))
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusBadRequest).
+			AssertBody(expect)
+	})
+
+	t.Run("uuid", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/things/0b5b1d3e-2a4c-4f52-9b7e-6f1d2e3c4b5a", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("0b5b1d3e-2a4c-4f52-9b7e-6f1d2e3c4b5a")
+	})
+
+	t.Run("uuid mismatch", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/things/nope", nil)
+
+		expect, _ := json.Marshal(vk.E(http.StatusBadRequest, "path parameter uuid must be a UUID"))
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusBadRequest).
+			AssertBody(expect)
+	})
+}
+
+func TestMatchesRegex(t *testing.T) {
+	c := vk.MatchesRegex("[a-z]+-[0-9]+")
+
+	if err := c("abc-123"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if err := c("abc-123-def"); err == nil {
+		t.Error("expected partial match to be rejected")
+	}
+}
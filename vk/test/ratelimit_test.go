@@ -0,0 +1,152 @@
+package test_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+	"github.com/suborbital/vektor/vtest"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+		vk.UseMiddleware(vk.RateLimit(vk.RateLimitPolicy{
+			Algorithm: vk.TokenBucket,
+			Limit:     10,
+			Window:    time.Minute,
+		})),
+	)
+
+	limited := vk.Group("/limited")
+	limited.GET("/hello", handleOK, vk.RateLimit(vk.RateLimitPolicy{
+		Algorithm: vk.SlidingWindow,
+		Limit:     2,
+		Window:    time.Minute,
+		Key:       vk.KeyByHeader("X-API-Key"),
+	}))
+
+	server.AddGroup(limited)
+	server.GET("/open", handleOK)
+
+	vt := vtest.New(server)
+
+	newReq := func(path, key string) *http.Request {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = "10.0.0.1:5555"
+
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+
+		return r
+	}
+
+	t.Run("route", func(t *testing.T) {
+		vt.Do(newReq("/limited/hello", "one"), t).
+			AssertStatus(http.StatusOK).
+			AssertHeader("RateLimit-Limit", "2").
+			AssertHeader("RateLimit-Remaining", "1")
+
+		vt.Do(newReq("/limited/hello", "one"), t).
+			AssertStatus(http.StatusOK)
+
+		res := vt.Do(newReq("/limited/hello", "one"), t).
+			AssertStatus(http.StatusTooManyRequests).
+			AssertBodyString(`{"status":429,"message":"Too Many Requests"}`)
+
+		if res.Headers.Get("Retry-After") == "" {
+			t.Error("missing Retry-After header")
+		}
+
+		// a different API key has its own quota
+		vt.Do(newReq("/limited/hello", "two"), t).
+			AssertStatus(http.StatusOK)
+	})
+
+	t.Run("server", func(t *testing.T) {
+		// the four requests above count against the server-wide limit too
+		for i := 0; i < 6; i++ {
+			vt.Do(newReq("/open", ""), t).AssertStatus(http.StatusOK)
+		}
+
+		vt.Do(newReq("/open", ""), t).
+			AssertStatus(http.StatusTooManyRequests).
+			AssertHeader("RateLimit-Remaining", "0")
+	})
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	start := time.Now()
+
+	t.Run("token bucket refills", func(t *testing.T) {
+		store := vk.NewMemoryRateLimitStore(10)
+		policy := vk.RateLimitPolicy{Algorithm: vk.TokenBucket, Limit: 2, Window: time.Second}
+
+		for i := 0; i < 2; i++ {
+			if res, _ := store.Allow("k", policy, start); !res.Allowed {
+				t.Fatalf("request %d unexpectedly denied", i)
+			}
+		}
+
+		res, _ := store.Allow("k", policy, start)
+		if res.Allowed {
+			t.Fatal("request over limit unexpectedly allowed")
+		}
+
+		if res.RetryAfter != 500*time.Millisecond {
+			t.Errorf("got RetryAfter %s, want 500ms", res.RetryAfter)
+		}
+
+		if res, _ := store.Allow("k", policy, start.Add(500*time.Millisecond)); !res.Allowed {
+			t.Error("request after refill unexpectedly denied")
+		}
+	})
+
+	t.Run("sliding window weights previous window", func(t *testing.T) {
+		store := vk.NewMemoryRateLimitStore(10)
+		policy := vk.RateLimitPolicy{Algorithm: vk.SlidingWindow, Limit: 4, Window: time.Second}
+
+		for i := 0; i < 4; i++ {
+			store.Allow("k", policy, start)
+		}
+
+		// a quarter of the way into the next window, 3 of the previous 4 still count
+		if res, _ := store.Allow("k", policy, start.Add(1250*time.Millisecond)); !res.Allowed {
+			t.Error("request unexpectedly denied")
+		}
+
+		if res, _ := store.Allow("k", policy, start.Add(1250*time.Millisecond)); res.Allowed {
+			t.Error("request over weighted limit unexpectedly allowed")
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		store := vk.NewMemoryRateLimitStore(3)
+		policy := vk.RateLimitPolicy{Limit: 1, Window: time.Second}
+
+		for i := 0; i < 5; i++ {
+			store.Allow(fmt.Sprintf("key-%d", i), policy, start)
+		}
+
+		if store.Len() != 3 {
+			t.Errorf("got %d keys, want 3", store.Len())
+		}
+
+		store.Allow("late", policy, start.Add(time.Minute))
+
+		if store.Len() != 1 {
+			t.Errorf("got %d keys after idle eviction, want 1", store.Len())
+		}
+	})
+}
+
+func handleOK(w http.ResponseWriter, _ *http.Request, ctx *vk.Ctx) error {
+	return vk.RespondString(ctx.Context, w, "ok", http.StatusOK)
+}
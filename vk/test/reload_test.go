@@ -0,0 +1,314 @@
+package test_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+	"github.com/suborbital/vektor/vtest"
+)
+
+func TestReload(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	path := writeConfig(t, "config.yaml", `
+http_port: -1
+bind_address: 127.0.0.1
+cors_origins: [https://a.example]
+rate_limit:
+  limit: 100
+  window: 1m
+`)
+
+	config, err := vk.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := vk.New(vk.UseConfig(config), vk.UseLogger(logger))
+
+	server.GET("/hello", handleOK)
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	url := "http://" + server.Addr().String() + "/hello"
+
+	if origin := corsOrigin(t, url, "https://a.example"); origin != "https://a.example" {
+		t.Errorf("got allowed origin %q before reload", origin)
+	}
+
+	rewrite := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an invalid config is rejected and nothing changes
+	rewrite("cors_origins: [https://b.example]\nhttp_port: 70000\n")
+
+	if _, err := server.Reload(); err == nil {
+		t.Error("expected reloading an invalid config to fail")
+	}
+
+	if origin := corsOrigin(t, url, "https://a.example"); origin != "https://a.example" {
+		t.Errorf("got allowed origin %q after failed reload", origin)
+	}
+
+	rewrite(`
+http_port: 9999
+bind_address: 127.0.0.1
+cors_origins: [https://b.example]
+rate_limit:
+  limit: 1
+  window: 1m
+`)
+
+	result, err := server.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !contains(result.Applied, "cors_origins") || !contains(result.Applied, "rate_limit") {
+		t.Errorf("got applied %v", result.Applied)
+	}
+
+	if len(result.RestartRequired) != 1 || result.RestartRequired[0] != "http_port" {
+		t.Errorf("got restart required %v", result.RestartRequired)
+	}
+
+	if origin := corsOrigin(t, url, "https://a.example"); origin != "" {
+		t.Errorf("got allowed origin %q for a removed origin", origin)
+	}
+
+	// the previous request used the new limit of 1
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", res.StatusCode, http.StatusTooManyRequests)
+	}
+
+	// settings removed from the config revert rather than keeping their reloaded values
+	rewrite("http_port: -1\nbind_address: 127.0.0.1\n")
+
+	result, err = server.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Applied) != 2 || len(result.RestartRequired) != 0 {
+		t.Errorf("got applied %v, restart required %v", result.Applied, result.RestartRequired)
+	}
+
+	if origin := corsOrigin(t, url, "https://b.example"); origin != "" {
+		t.Errorf("got allowed origin %q after the origins were removed", origin)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(vk.UseLogger(logger), vk.UseCORSOrigins("https://a.example"), vk.UseFallbackAddress("http://127.0.0.1:1"))
+
+	server.POST("/hello", handleOK)
+
+	if err := server.TestStart(); err != nil {
+		t.Fatal(err)
+	}
+
+	preflight := func(origin string) *http.Response {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodOptions, "/hello", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	res := preflight("https://a.example")
+
+	if res.StatusCode != http.StatusNoContent || res.Header.Get("Access-Control-Allow-Origin") != "https://a.example" {
+		t.Errorf("got status %d, allowed origin %q", res.StatusCode, res.Header.Get("Access-Control-Allow-Origin"))
+	}
+
+	if !strings.Contains(res.Header.Get("Access-Control-Allow-Methods"), http.MethodPost) ||
+		!strings.Contains(res.Header.Get("Access-Control-Allow-Headers"), "Content-Type") {
+		t.Errorf("got allowed methods %q, headers %q", res.Header.Get("Access-Control-Allow-Methods"), res.Header.Get("Access-Control-Allow-Headers"))
+	}
+
+	// other OPTIONS requests get httprouter's default reply
+	if res := preflight("https://b.example"); res.StatusCode != http.StatusOK || res.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("got status %d, allowed origin %q for an origin that isn't allowed", res.StatusCode, res.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestCORSPreflightReload(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(vk.UseLogger(logger))
+
+	server.POST("/hello", handleOK)
+
+	if err := server.TestStart(); err != nil {
+		t.Fatal(err)
+	}
+
+	preflight := func() *http.Response {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodOptions, "/hello", nil)
+		req.Header.Set("Origin", "https://a.example")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	// without CORS origins, OPTIONS requests get httprouter's default reply
+	if res := preflight(); res.StatusCode != http.StatusOK || res.Header.Get("Allow") != "OPTIONS, POST" || res.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("got status %d, allow %q, allowed origin %q", res.StatusCode, res.Header.Get("Allow"), res.Header.Get("Access-Control-Allow-Origin"))
+	}
+
+	t.Setenv("VK_CORS_ORIGINS", "https://a.example")
+
+	if _, err := server.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if res := preflight(); res.StatusCode != http.StatusNoContent || res.Header.Get("Access-Control-Allow-Origin") != "https://a.example" {
+		t.Errorf("got status %d, allowed origin %q after reload", res.StatusCode, res.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	t.Setenv("VK_QUIET_ROUTES", "/health")
+
+	server := vk.New(vk.UseLogger(logger), vk.UseHTTPPort(vk.EphemeralPort), vk.UseBindAddress("127.0.0.1"))
+
+	server.POST("/reload", server.ReloadHandler())
+
+	if err := server.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Stop()
+
+	t.Setenv("VK_QUIET_ROUTES", "/health,/ready")
+	t.Setenv("VK_LOG_LEVEL", "null")
+
+	res, err := http.Post("http://"+server.Addr().String()+"/reload", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	result := vk.ReloadResult{}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	// the log level isn't applied to a logger set with UseLogger
+	if len(result.Applied) != 1 || result.Applied[0] != "quiet_routes" || len(result.RestartRequired) != 0 {
+		t.Errorf("got applied %v, restart required %v", result.Applied, result.RestartRequired)
+	}
+
+	if logger.Level() != vlog.LogLevelNull {
+		t.Errorf("got level %s", logger.Level())
+	}
+}
+
+func TestReloadLogLevel(t *testing.T) {
+	path := writeConfig(t, "config.yaml", "log:\n  level: error\n")
+
+	config, err := vk.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the logger is created from the config
+	server := vk.New(vk.UseConfig(config))
+
+	server.GET("/level", func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		return vk.RespondString(ctx.Context, w, ctx.Log.Level(), http.StatusOK)
+	})
+
+	vt := vtest.New(server)
+
+	reload := func(contents, level string) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := server.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, _ := http.NewRequest(http.MethodGet, "/level", nil)
+		vt.Do(r, t).AssertBodyString(level)
+	}
+
+	reload("log:\n  level: warn\n", vlog.LogLevelWarn)
+
+	// removing the level restores the level the logger was created with
+	reload("app_name: reloaded\n", vlog.LogLevelError)
+}
+
+// corsOrigin makes a request from origin and returns the allowed origin in the response
+func corsOrigin(t *testing.T, url, origin string) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Origin", origin)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+
+	return res.Header.Get("Access-Control-Allow-Origin")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
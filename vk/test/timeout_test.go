@@ -0,0 +1,71 @@
+package test_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+	"github.com/suborbital/vektor/vtest"
+)
+
+func TestTimeout(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+	)
+
+	writeErr := make(chan error, 1)
+
+	g := vk.Group("")
+
+	g.GET("/fast", func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		if _, hasDeadline := ctx.Context.Deadline(); !hasDeadline {
+			return vk.E(http.StatusInternalServerError, "missing deadline")
+		}
+
+		ctx.RespHeaders.Set("X-Fast", "true")
+
+		return vk.RespondString(ctx.Context, w, "fast", http.StatusCreated)
+	}, vk.Timeout(time.Second))
+
+	g.GET("/slow", func(w http.ResponseWriter, r *http.Request, ctx *vk.Ctx) error {
+		<-ctx.Context.Done()
+
+		// give the middleware a moment to respond before attempting to write
+		time.Sleep(10 * time.Millisecond)
+
+		_, err := w.Write([]byte("too late"))
+		writeErr <- err
+
+		return nil
+	}, vk.Timeout(10*time.Millisecond))
+
+	server.AddGroup(g)
+
+	vt := vtest.New(server)
+
+	t.Run("completes", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/fast", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusCreated).
+			AssertHeader("X-Fast", "true").
+			AssertBodyString("fast")
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/slow", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusServiceUnavailable).
+			AssertBodyString(`{"status":503,"message":"request timed out"}`)
+
+		if err := <-writeErr; err != http.ErrHandlerTimeout {
+			t.Errorf("got write error %v, want http.ErrHandlerTimeout", err)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package test_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+	"github.com/suborbital/vektor/vtest"
+)
+
+func TestVersioning(t *testing.T) {
+	// suppress logging
+	logger := vlog.Default(vlog.Level(vlog.LogLevelError))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+	)
+
+	sunset := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	api := vk.Group("/api").WithVersioning(
+		vk.VersionByPath(),
+		vk.VersionByHeader("X-API-Version"),
+		vk.VersionByMediaType("version"),
+		vk.DefaultVersion(2),
+		vk.DeprecateVersion(1, time.Time{}, sunset),
+	)
+
+	handleUsers := func(w http.ResponseWriter, r *http.Request, c *vk.Ctx) error {
+		return vk.RespondString(c.Context, w, fmt.Sprintf("users v%d", c.APIVersion()), http.StatusOK)
+	}
+
+	handleUsersV3 := func(w http.ResponseWriter, r *http.Request, c *vk.Ctx) error {
+		return vk.RespondString(c.Context, w, "new users", http.StatusOK)
+	}
+
+	api.Versions(1, 2).GET("/users", handleUsers)
+	api.Versions(3, 0).GET("/users", handleUsersV3)
+	api.Versions(2, 0).GET("/teams", handleUsers)
+
+	server.AddGroup(api)
+
+	vt := vtest.New(server)
+
+	t.Run("path", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/api/v1/users", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("users v1").
+			AssertHeader("Deprecation", "true").
+			AssertHeader("Sunset", "Tue, 01 Jan 2030 00:00:00 GMT")
+	})
+
+	t.Run("path newer range", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/api/v3/users", nil)
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("new users")
+	})
+
+	t.Run("default", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/api/users", nil)
+
+		res := vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("users v2")
+
+		if res.Headers.Get("Deprecation") != "" {
+			t.Error("unexpected Deprecation header for v2")
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/api/users", nil)
+		r.Header.Set("X-API-Version", "3")
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("new users")
+	})
+
+	t.Run("media type", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/api/users", nil)
+		r.Header.Set("Accept", "application/json; version=1")
+
+		vt.Do(r, t).
+			AssertStatus(http.StatusOK).
+			AssertBodyString("users v1").
+			AssertHeader("Deprecation", "true")
+	})
+
+	t.Run("version not served by route", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/api/teams", nil)
+		r.Header.Set("X-API-Version", "1")
+
+		vt.Do(r, t).AssertStatus(http.StatusNotFound)
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/api/users", nil)
+		r.Header.Set("X-API-Version", "latest")
+
+		vt.Do(r, t).AssertStatus(http.StatusBadRequest)
+	})
+}
+
+func TestVersioningConflict(t *testing.T) {
+	logger := vlog.Default(vlog.Level(vlog.LogLevelNull))
+
+	server := vk.New(
+		vk.UseLogger(logger),
+	)
+
+	handler := func(w http.ResponseWriter, r *http.Request, c *vk.Ctx) error {
+		return nil
+	}
+
+	// the `/v1/users` path added for the versioned route conflicts with the wildcard
+	api := vk.Group("/api")
+	api.Versions(1, 0).GET("/users", handler)
+	api.GET("/:resource/users", handler)
+
+	server.AddGroup(api)
+
+	if err := server.TestStart(); err == nil {
+		t.Error("expected conflicting routes to return an error")
+	}
+}
@@ -0,0 +1,127 @@
+package vk
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout returns a Middleware that puts a deadline on the Ctx's Context (and the request's context), and responds
+// with a 503 vk.Error if the handler has not returned when the deadline passes. The handler's response is buffered
+// and only written once it returns, so anything written after the deadline is discarded, and writes made after the
+// deadline return http.ErrHandlerTimeout. As a result, Timeout should not be used with streaming or WebSocket handlers
+func Timeout(d time.Duration) Middleware {
+	return func(inner HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+			deadlineCtx, cancel := context.WithTimeout(ctx.Context, d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: http.Header{}}
+			for key, vals := range ctx.RespHeaders {
+				tw.header[key] = append([]string{}, vals...)
+			}
+
+			// the handler gets its own copy of the Ctx so that it can't race with
+			// the outer middleware if it continues running after the deadline
+			innerCtx := *ctx
+			innerCtx.Context = deadlineCtx
+			innerCtx.RespHeaders = tw.header
+
+			done := make(chan error, 1)
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+
+				done <- inner(tw, r.WithContext(deadlineCtx), &innerCtx)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+			case err := <-done:
+				tw.lock.Lock()
+				defer tw.lock.Unlock()
+
+				for key := range w.Header() {
+					w.Header().Del(key)
+				}
+
+				for key, vals := range tw.header {
+					w.Header()[key] = vals
+				}
+
+				if tw.code != 0 {
+					w.WriteHeader(tw.code)
+				}
+
+				if tw.buf.Len() > 0 {
+					if _, writeErr := w.Write(tw.buf.Bytes()); writeErr != nil && err == nil {
+						err = writeErr
+					}
+				}
+
+				// keep anything the handler changed on the Ctx, such as its scope
+				innerCtx.Context = ctx.Context
+				innerCtx.RespHeaders = ctx.RespHeaders
+				*ctx = innerCtx
+
+				return err
+			case <-deadlineCtx.Done():
+				tw.lock.Lock()
+				tw.timedOut = true
+				tw.lock.Unlock()
+
+				return E(http.StatusServiceUnavailable, "request timed out")
+			}
+		}
+	}
+}
+
+// timeoutWriter buffers a handler's response until it either completes or times out
+type timeoutWriter struct {
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+	lock     sync.Mutex
+}
+
+// Header implements http.ResponseWriter
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// Write implements http.ResponseWriter
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+
+	return tw.buf.Write(p)
+}
+
+// WriteHeader implements http.ResponseWriter
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+
+	tw.code = code
+}
@@ -0,0 +1,345 @@
+package vk
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersioningOptions configures how a RouteGroup selects the API version for a request
+type VersioningOptions struct {
+	ByPath         bool   // select the version from a `/v{n}` path segment directly after the group prefix
+	Header         string // select the version from a custom header, such as `X-API-Version: 2`
+	MediaTypeParam string // select the version from an Accept media type parameter, such as `Accept: application/json; version=2`
+	Default        int    // the version used for unversioned requests, 0 meaning the latest supported version
+	Deprecations   map[int]Deprecation
+}
+
+// Deprecation describes when an API version was deprecated and when it will be removed.
+// Either may be left as the zero time if unknown
+type Deprecation struct {
+	At     time.Time
+	Sunset time.Time
+}
+
+// VersioningModifier takes a VersioningOptions struct and modifies it
+type VersioningModifier func(*VersioningOptions)
+
+// VersionByPath selects the API version from a `/v{n}` path segment following the group prefix,
+// i.e. `/api/v2/users` for a group with prefix `/api`. The unversioned `/api/users` remains
+// available and is served by the version selected by the other methods, or by the default
+func VersionByPath() VersioningModifier {
+	return func(o *VersioningOptions) {
+		o.ByPath = true
+	}
+}
+
+// VersionByHeader selects the API version from the named request header
+func VersionByHeader(header string) VersioningModifier {
+	return func(o *VersioningOptions) {
+		o.Header = header
+	}
+}
+
+// VersionByMediaType selects the API version from the named parameter of the Accept header's media types
+func VersionByMediaType(param string) VersioningModifier {
+	return func(o *VersioningOptions) {
+		o.MediaTypeParam = param
+	}
+}
+
+// DefaultVersion sets the version used to serve requests that do not specify one
+func DefaultVersion(version int) VersioningModifier {
+	return func(o *VersioningOptions) {
+		o.Default = version
+	}
+}
+
+// DeprecateVersion marks an API version as deprecated, causing responses served by that
+// version to include the `Deprecation` and (if sunset is non-zero) `Sunset` headers
+func DeprecateVersion(version int, at, sunset time.Time) VersioningModifier {
+	return func(o *VersioningOptions) {
+		o.Deprecations[version] = Deprecation{At: at, Sunset: sunset}
+	}
+}
+
+// VersionedRoutes registers routes on a RouteGroup for a range of API versions
+type VersionedRoutes struct {
+	group    *RouteGroup
+	min, max int
+}
+
+// WithVersioning enables API versioning for the group. Routes registered using `Versions` are
+// served according to the version selected for each request, while routes registered directly
+// on the group are unaffected. If no selection method is provided, VersionByPath is used
+func (g *RouteGroup) WithVersioning(mods ...VersioningModifier) *RouteGroup {
+	g.versioning = newVersioningOptions(mods...)
+
+	return g
+}
+
+// Versions returns a VersionedRoutes that registers routes on the group for every version from min to max
+// inclusive. A max of 0 means the routes are served by every version from min onwards
+func (g *RouteGroup) Versions(min, max int) *VersionedRoutes {
+	return &VersionedRoutes{group: g, min: min, max: max}
+}
+
+// GET is a shortcut for vr.Handle(http.MethodGet, path, handler, middleware...)
+func (vr *VersionedRoutes) GET(path string, handler HandlerFunc, middleware ...Middleware) {
+	vr.Handle(http.MethodGet, path, handler, middleware...)
+}
+
+// HEAD is a shortcut for vr.Handle(http.MethodHead, path, handler, middleware...)
+func (vr *VersionedRoutes) HEAD(path string, handler HandlerFunc, middleware ...Middleware) {
+	vr.Handle(http.MethodHead, path, handler, middleware...)
+}
+
+// OPTIONS is a shortcut for vr.Handle(http.MethodOptions, path, handler, middleware...)
+func (vr *VersionedRoutes) OPTIONS(path string, handler HandlerFunc, middleware ...Middleware) {
+	vr.Handle(http.MethodOptions, path, handler, middleware...)
+}
+
+// POST is a shortcut for vr.Handle(http.MethodPost, path, handler, middleware...)
+func (vr *VersionedRoutes) POST(path string, handler HandlerFunc, middleware ...Middleware) {
+	vr.Handle(http.MethodPost, path, handler, middleware...)
+}
+
+// PUT is a shortcut for vr.Handle(http.MethodPut, path, handler, middleware...)
+func (vr *VersionedRoutes) PUT(path string, handler HandlerFunc, middleware ...Middleware) {
+	vr.Handle(http.MethodPut, path, handler, middleware...)
+}
+
+// PATCH is a shortcut for vr.Handle(http.MethodPatch, path, handler, middleware...)
+func (vr *VersionedRoutes) PATCH(path string, handler HandlerFunc, middleware ...Middleware) {
+	vr.Handle(http.MethodPatch, path, handler, middleware...)
+}
+
+// DELETE is a shortcut for vr.Handle(http.MethodDelete, path, handler, middleware...)
+func (vr *VersionedRoutes) DELETE(path string, handler HandlerFunc, middleware ...Middleware) {
+	vr.Handle(http.MethodDelete, path, handler, middleware...)
+}
+
+// Handle adds a route to be handled for the range of versions
+func (vr *VersionedRoutes) Handle(method, path string, handler HandlerFunc, middleware ...Middleware) {
+	rh := httpRouteHandler{
+		Method:   method,
+		Path:     path,
+		Handler:  WrapHandler(handler, middleware...),
+		versions: &versionRange{min: vr.min, max: vr.max},
+	}
+
+	vr.group.httpRoutes = append(vr.group.httpRoutes, rh)
+}
+
+func newVersioningOptions(mods ...VersioningModifier) *VersioningOptions {
+	opts := &VersioningOptions{
+		Deprecations: map[int]Deprecation{},
+	}
+
+	for _, mod := range mods {
+		mod(opts)
+	}
+
+	if !opts.ByPath && opts.Header == "" && opts.MediaTypeParam == "" {
+		opts.ByPath = true
+	}
+
+	return opts
+}
+
+type versionRange struct {
+	min, max int
+}
+
+// includes returns true if the version falls within the range, given the latest known version
+func (v versionRange) includes(version, latest int) bool {
+	max := v.max
+	if max == 0 {
+		max = latest
+	}
+
+	return version >= v.min && version <= max
+}
+
+// versionedRouteHandlers expands a set of versioned routes into the httpRouteHandlers that serve them,
+// with paths relative to the group. Each method and path gets one unversioned handler that selects
+// the version for the request, plus one handler per version under `/v{n}` if path selection is enabled
+func (o *VersioningOptions) versionedRouteHandlers(routes []httpRouteHandler) []httpRouteHandler {
+	supported := o.supportedVersions(routes)
+	latest := supported[len(supported)-1]
+
+	type routeKey struct{ method, path string }
+
+	keys := []routeKey{}
+	handlers := map[routeKey]map[int]HandlerFunc{}
+
+	for _, r := range routes {
+		key := routeKey{r.Method, r.Path}
+		if _, exists := handlers[key]; !exists {
+			keys = append(keys, key)
+			handlers[key] = map[int]HandlerFunc{}
+		}
+
+		for _, v := range supported {
+			if r.versions.includes(v, latest) {
+				handlers[key][v] = r.Handler
+			}
+		}
+	}
+
+	expanded := []httpRouteHandler{}
+
+	for _, key := range keys {
+		expanded = append(expanded, httpRouteHandler{
+			Method:  key.method,
+			Path:    key.path,
+			Handler: o.selectingHandler(handlers[key], latest),
+		})
+
+		if !o.ByPath {
+			continue
+		}
+
+		for _, v := range supported {
+			handler, exists := handlers[key][v]
+			if !exists {
+				continue
+			}
+
+			expanded = append(expanded, httpRouteHandler{
+				Method:  key.method,
+				Path:    fmt.Sprintf("/v%d%s", v, ensureLeadingSlash(key.path)),
+				Handler: o.versionHandler(v, handler),
+			})
+		}
+	}
+
+	return expanded
+}
+
+// supportedVersions returns the sorted set of versions mentioned by the routes, deprecations and default
+func (o *VersioningOptions) supportedVersions(routes []httpRouteHandler) []int {
+	seen := map[int]bool{}
+
+	if o.Default != 0 {
+		seen[o.Default] = true
+	}
+
+	for v := range o.Deprecations {
+		seen[v] = true
+	}
+
+	for _, r := range routes {
+		seen[r.versions.min] = true
+
+		if r.versions.max != 0 {
+			for v := r.versions.min; v <= r.versions.max; v++ {
+				seen[v] = true
+			}
+		}
+	}
+
+	supported := make([]int, 0, len(seen))
+	for v := range seen {
+		supported = append(supported, v)
+	}
+
+	sort.Ints(supported)
+
+	// open-ended ranges extend through the latest version, so fill in any gaps
+	if len(supported) > 0 {
+		filled := []int{}
+		for v := supported[0]; v <= supported[len(supported)-1]; v++ {
+			filled = append(filled, v)
+		}
+
+		supported = filled
+	}
+
+	return supported
+}
+
+// selectingHandler returns a HandlerFunc that selects the version for the request and calls the matching handler
+func (o *VersioningOptions) selectingHandler(handlers map[int]HandlerFunc, latest int) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+		version, err := o.versionFromRequest(r)
+		if err != nil {
+			return err
+		}
+
+		if version == 0 {
+			version = o.Default
+		}
+
+		if version == 0 {
+			version = latest
+		}
+
+		handler, exists := handlers[version]
+		if !exists {
+			return E(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		}
+
+		return o.versionHandler(version, handler)(w, r, ctx)
+	}
+}
+
+// versionHandler returns a HandlerFunc that records the version on the Ctx, sets any deprecation headers and calls handler
+func (o *VersioningOptions) versionHandler(version int, handler HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, ctx *Ctx) error {
+		ctx.apiVersion = version
+
+		if dep, deprecated := o.Deprecations[version]; deprecated {
+			if dep.At.IsZero() {
+				ctx.RespHeaders.Set("Deprecation", "true")
+			} else {
+				ctx.RespHeaders.Set("Deprecation", fmt.Sprintf("@%d", dep.At.Unix()))
+			}
+
+			if !dep.Sunset.IsZero() {
+				ctx.RespHeaders.Set("Sunset", dep.Sunset.UTC().Format(http.TimeFormat))
+			}
+		}
+
+		return handler(w, r, ctx)
+	}
+}
+
+// versionFromRequest returns the version requested by the header or the Accept media type, or 0 if neither is present
+func (o *VersioningOptions) versionFromRequest(r *http.Request) (int, error) {
+	if o.Header != "" {
+		if value := r.Header.Get(o.Header); value != "" {
+			return parseVersion(value)
+		}
+	}
+
+	if o.MediaTypeParam != "" {
+		for _, accept := range r.Header.Values("Accept") {
+			for _, mediaType := range strings.Split(accept, ",") {
+				_, params, err := mime.ParseMediaType(mediaType)
+				if err != nil {
+					continue
+				}
+
+				if value, exists := params[o.MediaTypeParam]; exists {
+					return parseVersion(value)
+				}
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+func parseVersion(value string) (int, error) {
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "v"))
+	if err != nil || version < 1 {
+		return 0, E(http.StatusBadRequest, fmt.Sprintf("invalid API version %q", value))
+	}
+
+	return version, nil
+}
@@ -59,6 +59,10 @@ func redactAndJoinInterfaces(msgs ...interface{}) string {
 		}
 	}
 
+	if msg == "" {
+		return ""
+	}
+
 	// get rid of that first space
 	return msg[1:]
 }
@@ -0,0 +1,103 @@
+package vlog
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// Fields can be implemented by errors to add context to the log when they are logged with Logger.Error.
+// The fields of every error in the chain are added, and are redacted in the same way as any other field
+type Fields interface {
+	LogFields() []Field
+}
+
+// stackTracer is implemented by errors from github.com/pkg/errors that record where they were created
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+// Caller is the location that a log was written from, included in logs when the WithCaller option is used
+type Caller struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Function string `json:"function"`
+
+	pc uintptr
+}
+
+// String returns the caller as file:line
+func (c Caller) String() string {
+	return c.File + ":" + strconv.Itoa(c.Line)
+}
+
+// callerAt returns the caller skip frames above the function calling callerAt
+func callerAt(skip int) *Caller {
+	pcs := [1]uintptr{}
+	if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return nil
+	}
+
+	return callerFromPC(pcs[0])
+}
+
+func callerFromPC(pc uintptr) *Caller {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.File == "" {
+		return nil
+	}
+
+	return &Caller{File: shortPath(frame.File), Line: frame.Line, Function: frame.Function, pc: pc}
+}
+
+// shortPath trims a file path to its package directory and file name
+func shortPath(path string) string {
+	dir, file := filepath.Split(path)
+
+	return filepath.Join(filepath.Base(dir), file)
+}
+
+// errorFields returns the fields describing an error: the messages of the errors it wraps, the stack trace of the
+// innermost error that has one, and the fields of any errors that implement Fields
+func errorFields(err error) []Field {
+	fields := []Field{}
+	chain := []string{}
+
+	var stack pkgerrors.StackTrace
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		// errors wrapped by github.com/pkg/errors repeat the message of the error that adds the stack
+		if msg := e.Error(); len(chain) == 0 || chain[len(chain)-1] != msg {
+			chain = append(chain, msg)
+		}
+
+		if tracer, hasStack := e.(stackTracer); hasStack {
+			stack = tracer.StackTrace()
+		}
+
+		if extractor, hasFields := e.(Fields); hasFields {
+			fields = append(fields, extractor.LogFields()...)
+		}
+	}
+
+	if len(chain) > 1 {
+		fields = append(fields, Field{Key: "error_chain", value: chain})
+	}
+
+	if len(stack) > 0 {
+		frames := make([]string, 0, len(stack))
+
+		for _, frame := range stack {
+			if caller := callerFromPC(uintptr(frame)); caller != nil {
+				frames = append(frames, caller.Function+" "+caller.String())
+			}
+		}
+
+		fields = append(fields, Field{Key: "stack", value: frames})
+	}
+
+	return fields
+}
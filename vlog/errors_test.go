@@ -0,0 +1,83 @@
+package vlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type notFoundError struct {
+	id     int
+	secret unsafeStruct
+}
+
+func (e notFoundError) Error() string {
+	return "not found"
+}
+
+func (e notFoundError) LogFields() []Field {
+	return []Field{Int("id", e.id), Any("secret", e.secret)}
+}
+
+func findThing() error {
+	return errors.WithStack(notFoundError{id: 7})
+}
+
+func TestErrorFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), ConsoleMirror(false))
+
+	err := fmt.Errorf("loading page: %w", errors.Wrap(findThing(), "finding thing"))
+	log.Error(err)
+
+	logged := struct {
+		Message string   `json:"log_message"`
+		Chain   []string `json:"error_chain"`
+		Stack   []string `json:"stack"`
+		ID      int      `json:"id"`
+		Secret  string   `json:"secret"`
+	}{}
+
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+		t.Fatal(err, buf.String())
+	}
+
+	expectedChain := []string{"loading page: finding thing: not found", "finding thing: not found", "not found"}
+	if fmt.Sprint(logged.Chain) != fmt.Sprint(expectedChain) {
+		t.Errorf("unexpected chain %q", logged.Chain)
+	}
+
+	// the stack is from the innermost error that has one
+	if len(logged.Stack) == 0 || !strings.HasPrefix(logged.Stack[0], "github.com/suborbital/vektor/vlog.findThing vlog/errors_test.go:") {
+		t.Errorf("unexpected stack %q", logged.Stack)
+	}
+
+	if logged.ID != 7 || logged.Secret != "[redacted vlog.unsafeStruct]" {
+		t.Errorf("unexpected fields from the error: %d, %q", logged.ID, logged.Secret)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), WithFormat(FormatLogfmt), ConsoleMirror(false), WithCaller())
+
+	log.Info("hello")
+
+	slog.New(NewSlogHandler(log)).Info("from slog")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(line, "caller=vlog/errors_test.go:") || !strings.Contains(line, "function=github.com/suborbital/vektor/vlog.TestCaller") {
+			t.Errorf("unexpected caller in %q", line)
+		}
+	}
+}
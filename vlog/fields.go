@@ -0,0 +1,160 @@
+package vlog
+
+import (
+	"fmt"
+	"time"
+)
+
+// badKey is used as the key of values passed to With without one
+const badKey = "!BADKEY"
+
+// Field is a key and value added to structured logs as its own JSON key, created with String, Int, Err, etc.
+// Fields can be passed to a Logger's methods alongside the message, or attached to a logger with With.
+// Values are only converted when a message is logged, and are redacted in the same way as messages
+type Field struct {
+	Key   string
+	value interface{}
+}
+
+// String creates a string Field
+func String(key, val string) Field {
+	return Field{Key: key, value: val}
+}
+
+// Int creates an int Field
+func Int(key string, val int) Field {
+	return Field{Key: key, value: val}
+}
+
+// Int64 creates an int64 Field
+func Int64(key string, val int64) Field {
+	return Field{Key: key, value: val}
+}
+
+// Float64 creates a float64 Field
+func Float64(key string, val float64) Field {
+	return Field{Key: key, value: val}
+}
+
+// Bool creates a bool Field
+func Bool(key string, val bool) Field {
+	return Field{Key: key, value: val}
+}
+
+// Duration creates a Field that is logged as a duration string such as 1.5s
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, value: val}
+}
+
+// Time creates a Field that is logged as an RFC 3339 timestamp
+func Time(key string, val time.Time) Field {
+	return Field{Key: key, value: val}
+}
+
+// Err creates a Field with the key "error" and the error's message
+func Err(err error) Field {
+	return Field{Key: "error", value: err}
+}
+
+// Any creates a Field with any value. Values that aren't primitives or a SafeStringer are redacted
+func Any(key string, val interface{}) Field {
+	return Field{Key: key, value: val}
+}
+
+// Value returns the value that is logged for the field
+func (f Field) Value() interface{} {
+	switch val := f.value.(type) {
+	case nil, string, bool, uint, uint8, uint16, uint32, uint64, int, int8, int16, int32, int64, float32, float64:
+		return val
+	case time.Duration:
+		return val.String()
+	case time.Time, []string:
+		return val
+	case SafeStringer:
+		return val.SafeString()
+	case error:
+		return val.Error()
+	default:
+		return fmt.Sprintf("[redacted %T]", val)
+	}
+}
+
+// With returns a logger that adds fields to everything it logs. Fields can be given as Fields, or as alternating
+// keys and values, i.e. log.With("user_id", id, vlog.Err(err))
+func (v *Logger) With(fields ...interface{}) *Logger {
+	wl := v.CreateScoped(v.scope)
+	wl.fields = append(append([]Field{}, v.fields...), fieldsFromArgs(fields)...)
+
+	return wl
+}
+
+// fieldsFromArgs converts the arguments of With to Fields
+func fieldsFromArgs(args []interface{}) []Field {
+	fields := make([]Field, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i].(type) {
+		case Field:
+			fields = append(fields, arg)
+		case string:
+			if i+1 == len(args) {
+				fields = append(fields, Field{Key: badKey, value: arg})
+				continue
+			}
+
+			fields = append(fields, Field{Key: arg, value: args[i+1]})
+			i++
+		default:
+			fields = append(fields, Field{Key: badKey, value: arg})
+		}
+	}
+
+	return fields
+}
+
+// splitFields separates the Fields passed to a log method from the message
+func splitFields(msgs []interface{}) ([]interface{}, []Field) {
+	var fields []Field
+
+	for _, m := range msgs {
+		if _, isField := m.(Field); isField {
+			fields = make([]Field, 0, len(msgs))
+			break
+		}
+	}
+
+	if fields == nil {
+		return msgs, nil
+	}
+
+	rest := make([]interface{}, 0, len(msgs))
+
+	for _, m := range msgs {
+		if f, isField := m.(Field); isField {
+			fields = append(fields, f)
+		} else {
+			rest = append(rest, m)
+		}
+	}
+
+	return rest, fields
+}
+
+// resolveFields converts the fields' values to the values that are logged, keeping only the last of any fields that
+// share a key
+func resolveFields(fields []Field) []Field {
+	last := make(map[string]int, len(fields))
+	for i, f := range fields {
+		last[f.Key] = i
+	}
+
+	resolved := make([]Field, 0, len(last))
+
+	for i, f := range fields {
+		if last[f.Key] == i {
+			resolved = append(resolved, Field{Key: f.Key, value: f.Value()})
+		}
+	}
+
+	return resolved
+}
@@ -0,0 +1,79 @@
+package vlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(Level(LogLevelInfo), WithWriter(buf))
+
+	reqLog := log.With("user_id", 42, String("request_id", "abc"), "secret", unsafeStruct{Name: "Jeremy"})
+	reqLog.Info("signed in", safeStruct{Name: "Anthony"}, Err(errors.New("bad password")), Duration("took", 1500*time.Millisecond), Int("level", 3))
+
+	logged := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+		t.Fatal(err, buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"log_message":  "(I) signed in Anthony",
+		"user_id":      float64(42),
+		"request_id":   "abc",
+		"secret":       "[redacted vlog.unsafeStruct]",
+		"error":        "bad password",
+		"took":         "1.5s",
+		"fields.level": float64(3),
+		"level":        float64(3),
+	}
+
+	for key, val := range expected {
+		if logged[key] != val {
+			t.Errorf("expected %s to be %v, got %v", key, val, logged[key])
+		}
+	}
+
+	// fields passed to the logger don't change it
+	buf.Reset()
+	log.Info("plain")
+
+	if strings.Contains(buf.String(), "user_id") {
+		t.Errorf("unexpected fields: %s", buf.String())
+	}
+}
+
+type countingStringer struct {
+	count *int
+}
+
+func (c countingStringer) SafeString() string {
+	*c.count++
+	return "counted"
+}
+
+func TestFieldsLazy(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(Level(LogLevelInfo), WithWriter(buf))
+
+	count := 0
+	log.With("counter", countingStringer{&count}).Debug("not logged", Any("also", countingStringer{&count}))
+
+	if count != 0 || buf.Len() != 0 {
+		t.Errorf("expected disabled levels not to format, got %d calls and %q", count, buf.String())
+	}
+
+	log.With("counter", countingStringer{&count}, "dangling").Info(String("only", "fields"))
+
+	if count != 1 {
+		t.Errorf("expected the field to be formatted once, got %d", count)
+	}
+
+	if !strings.Contains(buf.String(), `"counter":"counted","!BADKEY":"dangling","only":"fields"`) {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+}
@@ -0,0 +1,298 @@
+package vlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Format is the format that logs are written in
+type Format string
+
+// FormatJSON and others are the available log formats
+const (
+	FormatJSON   Format = "json"   // structured JSON, one object per line (the default)
+	FormatText   Format = "text"   // the message followed by its fields as key=value pairs
+	FormatLogfmt Format = "logfmt" // every part of the log as key=value pairs
+	FormatPretty Format = "pretty" // colourised text with a short timestamp, for reading logs while developing
+)
+
+// TimeFormatUnix and TimeFormatUnixMilli log timestamps as numbers rather than with a time layout
+const (
+	TimeFormatUnix      = "unix"
+	TimeFormatUnixMilli = "unixmilli"
+)
+
+const prettyTimeFormat = "15:04:05.000"
+
+// ANSI escape codes used by FormatPretty
+const (
+	colorReset = "\033[0m"
+	colorDim   = "\033[2m"
+	colorCyan  = "\033[36m"
+)
+
+var levelColors = map[int]string{
+	1: "\033[31m", // red
+	2: "\033[33m", // yellow
+	3: "\033[32m", // green
+	4: "\033[34m", // blue
+	5: "\033[90m", // grey
+}
+
+// FieldNames are the keys used for the parts of every log by the JSON and logfmt formats.
+// Empty names keep their defaults: log_message, timestamp, and level
+type FieldNames struct {
+	Message   string
+	Timestamp string
+	Level     string
+}
+
+func formatFromString(format string) (Format, bool) {
+	switch f := Format(strings.ToLower(format)); f {
+	case FormatJSON, FormatText, FormatLogfmt, FormatPretty:
+		return f, true
+	}
+
+	return "", false
+}
+
+// encode formats a log as a line in the provided format
+func (o *Options) encode(format Format, entry structuredLog) []byte {
+	switch format {
+	case FormatText:
+		return o.encodeText(entry)
+	case FormatLogfmt:
+		return o.encodeLogfmt(entry)
+	case FormatPretty:
+		return o.encodePretty(entry)
+	default:
+		return o.encodeJSON(entry)
+	}
+}
+
+func (o *Options) encodeJSON(entry structuredLog) []byte {
+	names := o.fieldNames()
+
+	buf := []byte{'{'}
+	buf = appendJSONPair(buf, names.Message, entry.LogMessage)
+	buf = appendJSONPair(buf, names.Timestamp, o.timestamp(entry.Timestamp))
+	buf = appendJSONPair(buf, names.Level, entry.Level)
+
+	if entry.AppMeta != nil {
+		buf = appendJSONPair(buf, "app", entry.AppMeta)
+	}
+
+	if entry.ScopeMeta != nil {
+		buf = appendJSONPair(buf, "scope", entry.ScopeMeta)
+	}
+
+	if entry.Logger != "" {
+		buf = appendJSONPair(buf, "logger", entry.Logger)
+	}
+
+	if entry.Caller != nil {
+		buf = appendJSONPair(buf, "caller", entry.Caller)
+	}
+
+	for _, f := range entry.Fields {
+		buf = appendJSONPair(buf, names.fieldKey(f.Key), f.value)
+	}
+
+	return append(buf, '}', '\n')
+}
+
+func appendJSONPair(buf []byte, key string, val interface{}) []byte {
+	valJSON, err := json.Marshal(val)
+	if err != nil {
+		// values such as NaN can't be represented in JSON
+		if _, isFloat := val.(float64); !isFloat {
+			os.Stderr.Write([]byte("[vlog] failed to marshal " + key + " for structured log: " + err.Error() + "\n"))
+		}
+
+		valJSON, _ = json.Marshal(fmt.Sprint(val))
+	}
+
+	keyJSON, _ := json.Marshal(key)
+
+	if len(buf) > 1 {
+		buf = append(buf, ',')
+	}
+
+	buf = append(buf, keyJSON...)
+	buf = append(buf, ':')
+
+	return append(buf, valJSON...)
+}
+
+func (o *Options) encodeText(entry structuredLog) []byte {
+	buf := []byte(entry.LogMessage)
+
+	if entry.Logger != "" {
+		buf = appendKeyValue(buf, "logger", entry.Logger)
+	}
+
+	if entry.Caller != nil {
+		buf = appendKeyValue(buf, "caller", entry.Caller.String())
+	}
+
+	for _, f := range entry.Fields {
+		buf = appendKeyValue(buf, f.Key, f.value)
+	}
+
+	return append(buf, '\n')
+}
+
+func (o *Options) encodeLogfmt(entry structuredLog) []byte {
+	names := o.fieldNames()
+
+	buf := []byte{}
+	buf = appendKeyValue(buf, names.Timestamp, o.timestamp(entry.Timestamp))
+	buf = appendKeyValue(buf, names.Level, logLevelStringFromVal(entry.Level))
+
+	if entry.Logger != "" {
+		buf = appendKeyValue(buf, "logger", entry.Logger)
+	}
+
+	if entry.Caller != nil {
+		buf = appendKeyValue(buf, "caller", entry.Caller.String())
+		buf = appendKeyValue(buf, "function", entry.Caller.Function)
+	}
+
+	buf = appendKeyValue(buf, names.Message, entry.LogMessage)
+
+	if entry.AppMeta != nil {
+		buf = appendKeyValue(buf, "app", jsonString(entry.AppMeta))
+	}
+
+	if entry.ScopeMeta != nil {
+		buf = appendKeyValue(buf, "scope", jsonString(entry.ScopeMeta))
+	}
+
+	for _, f := range entry.Fields {
+		buf = appendKeyValue(buf, names.fieldKey(f.Key), f.value)
+	}
+
+	// drop the leading space
+	return append(buf[1:], '\n')
+}
+
+func (o *Options) encodePretty(entry structuredLog) []byte {
+	layout := o.TimeFormat
+	if layout == "" {
+		layout = prettyTimeFormat
+	}
+
+	buf := []byte(colorDim + formatTime(entry.Timestamp, layout) + colorReset + " ")
+	buf = append(buf, levelColors[entry.Level]+entry.LogMessage+colorReset...)
+
+	if entry.Logger != "" {
+		buf = append(buf, " "+colorCyan+"logger="+colorReset+entry.Logger...)
+	}
+
+	if entry.Caller != nil {
+		buf = append(buf, " "+colorDim+entry.Caller.String()+colorReset...)
+	}
+
+	for _, f := range entry.Fields {
+		buf = append(buf, " "+colorCyan+f.Key+"="+colorReset+textValue(f.value)...)
+	}
+
+	return append(buf, '\n')
+}
+
+// appendKeyValue appends a space and a key=value pair, quoting the value if needed
+func appendKeyValue(buf []byte, key string, val interface{}) []byte {
+	return append(buf, " "+key+"="+textValue(val)...)
+}
+
+// textValue formats a value for a text line, quoting it if it could be mistaken for more than one value or contains
+// characters that aren't printable, such as a newline or terminal escape sequence that could fake or hide lines
+func textValue(val interface{}) string {
+	var text string
+
+	switch v := val.(type) {
+	case string:
+		text = v
+	case time.Time:
+		text = v.Format(time.RFC3339)
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	if text == "" || strings.ContainsAny(text, " \"=") || strings.IndexFunc(text, isNotPrint) >= 0 {
+		text = strconv.Quote(text)
+	}
+
+	return text
+}
+
+func isNotPrint(r rune) bool {
+	return !unicode.IsPrint(r)
+}
+
+func jsonString(val interface{}) string {
+	valJSON, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("[unmarshallable %T]", val)
+	}
+
+	return string(valJSON)
+}
+
+// timestamp returns the value logged for a timestamp, according to the TimeFormat
+func (o *Options) timestamp(t time.Time) interface{} {
+	switch o.TimeFormat {
+	case TimeFormatUnix:
+		return t.Unix()
+	case TimeFormatUnixMilli:
+		return t.UnixMilli()
+	case "":
+		return t.Format(time.RFC3339Nano)
+	default:
+		return t.Format(o.TimeFormat)
+	}
+}
+
+func formatTime(t time.Time, layout string) string {
+	switch layout {
+	case TimeFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimeFormatUnixMilli:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		return t.Format(layout)
+	}
+}
+
+func (o *Options) fieldNames() FieldNames {
+	names := FieldNames{Message: "log_message", Timestamp: "timestamp", Level: "level"}
+
+	if o.FieldNames.Message != "" {
+		names.Message = o.FieldNames.Message
+	}
+
+	if o.FieldNames.Timestamp != "" {
+		names.Timestamp = o.FieldNames.Timestamp
+	}
+
+	if o.FieldNames.Level != "" {
+		names.Level = o.FieldNames.Level
+	}
+
+	return names
+}
+
+// fieldKey returns the key for a field, prefixed with "fields." if it would clash with the key of a part of every log
+func (n FieldNames) fieldKey(key string) string {
+	switch key {
+	case n.Message, n.Timestamp, n.Level, "app", "scope", "logger", "caller":
+		return "fields." + key
+	}
+
+	return key
+}
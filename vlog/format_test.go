@@ -0,0 +1,79 @@
+package vlog
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormats(t *testing.T) {
+	timestamp := time.Date(2022, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	entry := structuredLog{
+		LogMessage: "(I) hello world",
+		Timestamp:  timestamp,
+		Level:      3,
+		AppMeta:    map[string]string{"version": "v1"},
+		Logger:     "store",
+		Fields:     resolveFields([]Field{String("user", "a b"), Int("level", 2)}),
+	}
+
+	tests := []struct {
+		format   Format
+		opts     Options
+		expected string
+	}{
+		{FormatJSON, Options{}, `{"log_message":"(I) hello world","timestamp":"2022-06-01T12:30:00Z","level":3,"app":{"version":"v1"},"logger":"store","user":"a b","fields.level":2}`},
+		{FormatJSON, Options{TimeFormat: TimeFormatUnix, FieldNames: FieldNames{Message: "msg", Level: "severity"}}, `{"msg":"(I) hello world","timestamp":1654086600,"severity":3,"app":{"version":"v1"},"logger":"store","user":"a b","level":2}`},
+		{FormatText, Options{}, `(I) hello world logger=store user="a b" level=2`},
+		{FormatLogfmt, Options{TimeFormat: time.Kitchen}, `timestamp=12:30PM level=info logger=store log_message="(I) hello world" app="{\"version\":\"v1\"}" user="a b" fields.level=2`},
+		{FormatPretty, Options{}, "\033[2m12:30:00.000\033[0m \033[32m(I) hello world\033[0m \033[36mlogger=\033[0mstore \033[36muser=\033[0m\"a b\" \033[36mlevel=\033[0m2"},
+	}
+
+	for _, test := range tests {
+		if out := string(test.opts.encode(test.format, entry)); out != test.expected+"\n" {
+			t.Errorf("unexpected %s output:\n%s\nexpected:\n%s", test.format, out, test.expected)
+		}
+	}
+}
+
+func TestTextValueEscaping(t *testing.T) {
+	entry := structuredLog{
+		LogMessage: "(I) login",
+		Level:      3,
+		Fields:     resolveFields([]Field{String("user", "x\r\x1b[2K(I)admin"), String("note", "tab\there")}),
+	}
+
+	// control characters are escaped so that a value can't fake or hide log lines
+	expected := `(I) login user="x\r\x1b[2K(I)admin" note="tab\there"`
+
+	if out := string((&Options{}).encode(FormatText, entry)); out != expected+"\n" {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", out, expected)
+	}
+}
+
+func TestFormatFromEnv(t *testing.T) {
+	t.Setenv("VLOG_LOG_FORMAT", "logfmt")
+	t.Setenv("VLOG_LOG_CONSOLE_MIRROR", "false")
+
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), WithFormat(FormatJSON))
+
+	if log.writer.mirror {
+		t.Error("expected the console mirror to be disabled")
+	}
+
+	log.Info("hello")
+
+	if !strings.HasSuffix(buf.String(), ` level=info log_message="(I) hello"`+"\n") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	os.Unsetenv("VLOG_LOG_FORMAT")
+
+	if log := Default(WithWriter(buf), WithFormat("xml")); log.opts.Format != FormatJSON {
+		t.Errorf("expected an invalid format to fall back to json, got %s", log.opts.Format)
+	}
+}
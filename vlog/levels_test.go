@@ -0,0 +1,49 @@
+package vlog
+
+import "testing"
+
+func TestNamedLevels(t *testing.T) {
+	log := Default(Level(LogLevelInfo))
+
+	store := log.Named("store")
+	cache := store.Named("cache")
+	http := log.Named("http")
+
+	if cache.name != "store.cache" {
+		t.Errorf("unexpected name: %s", cache.name)
+	}
+
+	log.SetNamedLevel("store", LogLevelDebug)
+
+	if !cache.levels.enabled(cache.name, 4) || !store.levels.enabled(store.name, 4) {
+		t.Error("expected debug to be enabled for store and store.cache")
+	}
+
+	if http.levels.enabled(http.name, 4) || log.levels.enabled(log.name, 4) {
+		t.Error("expected debug to be disabled outside of store")
+	}
+
+	cache.SetNamedLevel("store.cache", LogLevelError)
+
+	if cache.levels.enabled(cache.name, 3) {
+		t.Error("expected the more specific override to be used")
+	}
+
+	// scoped loggers keep their name and share the levels
+	scoped := cache.CreateScoped("scope")
+	log.ClearNamedLevel("store.cache")
+
+	if !scoped.levels.enabled(scoped.name, 4) {
+		t.Error("expected the scoped logger to use the store override")
+	}
+
+	log.SetLevel(LogLevelError)
+
+	if http.levels.enabled(http.name, 3) || !scoped.levels.enabled(scoped.name, 4) {
+		t.Error("expected SetLevel to apply to loggers without an override only")
+	}
+
+	if levels := log.NamedLevels(); len(levels) != 1 || levels["store"] != LogLevelDebug {
+		t.Errorf("unexpected named levels: %v", levels)
+	}
+}
@@ -1,12 +1,13 @@
 package vlog
 
 import (
-	"context"
-	"fmt"
 	"io"
+	"log/slog"
+	"os"
 	"strings"
+	"time"
 
-	"github.com/sethvargo/go-envconfig"
+	"github.com/suborbital/vektor/internal/env"
 )
 
 const defaultEnvPrefix = "VLOG_"
@@ -40,6 +41,24 @@ type Options struct {
 	EnvPrefix    string
 	AppMeta      interface{}
 	PreLogHook   LogHookFunc
+	SlogHandler  slog.Handler
+
+	Format         Format `env:"LOG_FORMAT"`
+	ConsoleMirror  *bool  `env:"LOG_CONSOLE_MIRROR"` // mirror logs to stdout, by default only if the output isn't stdout
+	ConsoleFormat  Format `env:"LOG_CONSOLE_FORMAT"`
+	TimeFormat     string `env:"LOG_TIME_FORMAT"`
+	FieldNames     FieldNames
+	BufferSize     int            `env:"LOG_BUFFER_SIZE"` // write logs asynchronously, buffering up to this many
+	Overflow       OverflowPolicy `env:"LOG_OVERFLOW"`
+	Rotation       RotationPolicy
+	FileMode       os.FileMode // permissions of a new log file, 0644 by default
+	ReopenOnSIGHUP bool        `env:"LOG_REOPEN_ON_SIGHUP"`
+	Sinks          []Sink
+	Sampling       SamplingPolicy
+	DedupWindow    time.Duration `env:"LOG_DEDUP_WINDOW"`
+	Caller         bool          `env:"LOG_CALLER"`
+	TraceThreshold time.Duration `env:"LOG_TRACE_THRESHOLD"`
+	TraceSummary   bool          `env:"LOG_TRACE_SUMMARY"`
 }
 
 type LogHookFunc func([]byte)
@@ -113,6 +132,128 @@ func PreLogHook(hook LogHookFunc) OptionsModifier {
 	}
 }
 
+// WithSlogHandler sends logs to a slog.Handler instead of writing them to the output, see FromSlog
+func WithSlogHandler(handler slog.Handler) OptionsModifier {
+	return func(opt *Options) {
+		opt.SlogHandler = handler
+	}
+}
+
+// WithFormat sets the format that logs are written to the output in: json (the default), text, logfmt, or pretty
+func WithFormat(format Format) OptionsModifier {
+	return func(opt *Options) {
+		opt.Format = format
+	}
+}
+
+// ConsoleMirror sets whether logs are also written to stdout in the console format. By default they are
+// only if the output isn't stdout
+func ConsoleMirror(enabled bool) OptionsModifier {
+	return func(opt *Options) {
+		opt.ConsoleMirror = &enabled
+	}
+}
+
+// ConsoleFormat sets the format of logs mirrored to stdout, text by default
+func ConsoleFormat(format Format) OptionsModifier {
+	return func(opt *Options) {
+		opt.ConsoleFormat = format
+	}
+}
+
+// TimeFormat sets the layout used for timestamps (see time.Layout), or TimeFormatUnix or TimeFormatUnixMilli
+// to log them as numbers. By default timestamps are RFC 3339 with nanoseconds
+func TimeFormat(layout string) OptionsModifier {
+	return func(opt *Options) {
+		opt.TimeFormat = layout
+	}
+}
+
+// WithFieldNames sets the keys of the message, timestamp and level in the JSON and logfmt formats
+func WithFieldNames(names FieldNames) OptionsModifier {
+	return func(opt *Options) {
+		opt.FieldNames = names
+	}
+}
+
+// Async makes the logger write asynchronously, buffering up to bufferSize logs so that logging doesn't wait for
+// the output. When the buffer is full the oldest log is dropped (OverflowDrop) or logging waits (OverflowBlock).
+// Use Close or Flush before exiting to write any buffered logs
+func Async(bufferSize int, overflow OverflowPolicy) OptionsModifier {
+	return func(opt *Options) {
+		opt.BufferSize = bufferSize
+		opt.Overflow = overflow
+	}
+}
+
+// WithRotation sets when the file opened with ToFile is rotated and how many rotated files are kept
+func WithRotation(policy RotationPolicy) OptionsModifier {
+	return func(opt *Options) {
+		opt.Rotation = policy
+	}
+}
+
+// FileMode sets the permissions of the file created by ToFile, 0644 by default
+func FileMode(mode os.FileMode) OptionsModifier {
+	return func(opt *Options) {
+		opt.FileMode = mode
+	}
+}
+
+// ReopenOnSIGHUP reopens the file opened with ToFile each time the process receives SIGHUP,
+// so that it can be rotated by an external tool such as logrotate
+func ReopenOnSIGHUP() OptionsModifier {
+	return func(opt *Options) {
+		opt.ReopenOnSIGHUP = true
+	}
+}
+
+// WithSink adds a Sink that logs are written to in addition to the logger's output. Sinks only receive
+// logs at levels the logger logs, further limited by the sink's own level and filter
+func WithSink(sink Sink) OptionsModifier {
+	return func(opt *Options) {
+		opt.Sinks = append(opt.Sinks, sink)
+	}
+}
+
+// WithSampling limits how often the same message is logged, see SamplingPolicy
+func WithSampling(policy SamplingPolicy) OptionsModifier {
+	return func(opt *Options) {
+		opt.Sampling = policy
+	}
+}
+
+// Dedupe collapses identical logs (the same message at the same level from the same logger, with the same scope and
+// fields) that are logged one after another within the window, writing a "repeated N times" summary once a different
+// message is logged or the logger is flushed
+func Dedupe(window time.Duration) OptionsModifier {
+	return func(opt *Options) {
+		opt.DedupWindow = window
+	}
+}
+
+// WithCaller includes the file, line and function that each log was written from
+func WithCaller() OptionsModifier {
+	return func(opt *Options) {
+		opt.Caller = true
+	}
+}
+
+// TraceThreshold only logs spans that take at least the threshold, logging just their completion
+func TraceThreshold(threshold time.Duration) OptionsModifier {
+	return func(opt *Options) {
+		opt.TraceThreshold = threshold
+	}
+}
+
+// TraceSummary aggregates the durations of spans by name instead of logging each one, writing a summary of them
+// when the logger is flushed or closed
+func TraceSummary() OptionsModifier {
+	return func(opt *Options) {
+		opt.TraceSummary = true
+	}
+}
+
 func defaultOptions() *Options {
 	o := &Options{
 		Level:       logLevelValFromString(LogLevelInfo),
@@ -128,29 +269,53 @@ func defaultOptions() *Options {
 
 // finalize "locks in" the options by overriding any existing options with the version from the environment, and setting the default logger if needed
 func (o *Options) finalize(envPrefix string) {
-	envOpts := Options{}
-	if err := envconfig.ProcessWith(context.Background(), &envOpts, envconfig.PrefixLookuper(envPrefix, envconfig.OsLookuper())); err != nil {
-		fmt.Printf("[vlog] failed to ProcessWith environment config:" + err.Error())
-		return
+	for _, err := range env.Load(envPrefix, o) {
+		os.Stderr.Write([]byte("[vlog] ignoring invalid environment config: " + err.Error() + "\n"))
 	}
 
-	o.replaceFieldsIfNeeded(&envOpts)
-}
+	if o.LevelString != "" {
+		o.Level = logLevelValFromString(o.LevelString)
+	}
 
-func (o *Options) replaceFieldsIfNeeded(replacement *Options) {
-	if replacement.LevelString != "" {
-		o.Level = logLevelValFromString(replacement.LevelString)
+	if o.Format == "" {
+		o.Format = FormatJSON
+	} else if format, ok := formatFromString(string(o.Format)); ok {
+		o.Format = format
+	} else {
+		os.Stderr.Write([]byte("[vlog] invalid log format " + string(o.Format) + ", using json\n"))
+		o.Format = FormatJSON
 	}
 
-	if replacement.Filepath != "" {
-		o.Filepath = replacement.Filepath
+	if o.ConsoleFormat == "" {
+		o.ConsoleFormat = FormatText
+	} else if format, ok := formatFromString(string(o.ConsoleFormat)); ok {
+		o.ConsoleFormat = format
+	} else {
+		os.Stderr.Write([]byte("[vlog] invalid console log format " + string(o.ConsoleFormat) + ", using text\n"))
+		o.ConsoleFormat = FormatText
 	}
 
-	if replacement.LogPrefix != "" {
-		o.LogPrefix = replacement.LogPrefix
+	switch overflow := OverflowPolicy(strings.ToLower(string(o.Overflow))); overflow {
+	case OverflowDrop, OverflowBlock:
+		o.Overflow = overflow
+	case "":
+		o.Overflow = OverflowDrop
+	default:
+		os.Stderr.Write([]byte("[vlog] invalid overflow policy " + string(o.Overflow) + ", using drop\n"))
+		o.Overflow = OverflowDrop
 	}
 }
 
+func logLevelStringFromVal(val int) string {
+	for level, v := range levelStringMap {
+		if v == val {
+			return level
+		}
+	}
+
+	return LogLevelInfo
+}
+
 func logLevelValFromString(level string) int {
 	if level, ok := levelStringMap[strings.ToLower(level)]; ok {
 		return level
@@ -0,0 +1,356 @@
+package vlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultFileMode is the permissions of log files created by ToFile
+const defaultFileMode os.FileMode = 0644
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotationPolicy configures when a log file opened with ToFile is rotated, by renaming it with a timestamp
+// (app.log becomes app-2006-01-02T15-04-05.000.log) and starting a new file, and which rotated files are kept.
+// Zero values disable each setting
+type RotationPolicy struct {
+	MaxSizeMB  int           `env:"LOG_MAX_SIZE_MB"`  // rotate once the file would grow beyond this size
+	Every      time.Duration `env:"LOG_ROTATE_EVERY"` // rotate at every multiple of this interval, i.e. 24h rotates at midnight UTC
+	MaxBackups int           `env:"LOG_MAX_BACKUPS"`  // the number of rotated files to keep
+	MaxAge     time.Duration `env:"LOG_MAX_AGE"`      // remove rotated files older than this
+	Compress   bool          `env:"LOG_COMPRESS"`     // gzip rotated files
+}
+
+// rotatingFile is a log file that is rotated according to a RotationPolicy, and can be reopened after being moved
+type rotatingFile struct {
+	path    string
+	mode    os.FileMode
+	policy  RotationPolicy
+	maxSize int64
+
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	cleanup     sync.WaitGroup // rotated files being compressed or removed
+	cleanupLock sync.Mutex
+	stopSignal  chan struct{}
+	stopOnce    sync.Once
+}
+
+func openRotatingFile(path string, mode os.FileMode, policy RotationPolicy, reopenOnSIGHUP bool) (*rotatingFile, error) {
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+
+	rf := &rotatingFile{
+		path:       path,
+		mode:       mode,
+		policy:     policy,
+		maxSize:    int64(policy.MaxSizeMB) * 1024 * 1024,
+		stopSignal: make(chan struct{}),
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	if reopenOnSIGHUP {
+		rf.reopenOnSIGHUP()
+	}
+
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, rf.mode)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	rf.openedAt = time.Now()
+
+	return nil
+}
+
+// Write writes to the file, rotating it first if needed
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.shouldRotate(len(p)) {
+		if err := rf.rotate(); err != nil {
+			os.Stderr.Write([]byte("[vlog] failed to rotate log file: " + err.Error() + "\n"))
+		}
+	}
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+func (rf *rotatingFile) shouldRotate(writeLen int) bool {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(writeLen) > rf.maxSize {
+		return true
+	}
+
+	if rf.policy.Every > 0 && !time.Now().Truncate(rf.policy.Every).Equal(rf.openedAt.Truncate(rf.policy.Every)) {
+		return true
+	}
+
+	return false
+}
+
+// rotate moves the current file aside and opens a new one, then compresses and removes rotated files in the background
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	rf.file = nil
+
+	backup := rf.backupName(time.Now())
+	if err := os.Rename(rf.path, backup); err != nil {
+		// keep writing to the current file rather than losing logs
+		if openErr := rf.open(); openErr != nil {
+			return openErr
+		}
+
+		return err
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.cleanup.Add(1)
+
+	go func() {
+		defer rf.cleanup.Done()
+
+		rf.cleanupBackups(backup)
+	}()
+
+	return nil
+}
+
+// backupName returns the name a file rotated at t is renamed to
+func (rf *rotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := rf.backupParts()
+
+	return filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+}
+
+func (rf *rotatingFile) backupParts() (dir, prefix, ext string) {
+	dir, name := filepath.Split(rf.path)
+	ext = filepath.Ext(name)
+
+	return dir, strings.TrimSuffix(name, ext) + "-", ext
+}
+
+// cleanupBackups compresses the newly rotated file if needed and removes any rotated files that shouldn't be kept
+func (rf *rotatingFile) cleanupBackups(rotated string) {
+	// cleanups run one at a time so that one doesn't remove a file that another is compressing
+	rf.cleanupLock.Lock()
+	defer rf.cleanupLock.Unlock()
+
+	if rf.policy.Compress {
+		if err := compressFile(rotated, rf.mode); err != nil {
+			os.Stderr.Write([]byte("[vlog] failed to compress rotated log file: " + err.Error() + "\n"))
+		}
+	}
+
+	if rf.policy.MaxBackups <= 0 && rf.policy.MaxAge <= 0 {
+		return
+	}
+
+	backups, err := rf.backups()
+	if err != nil {
+		os.Stderr.Write([]byte("[vlog] failed to list rotated log files: " + err.Error() + "\n"))
+		return
+	}
+
+	for i, backup := range backups {
+		tooMany := rf.policy.MaxBackups > 0 && i >= rf.policy.MaxBackups
+		tooOld := rf.policy.MaxAge > 0 && time.Since(backup.rotatedAt) > rf.policy.MaxAge
+
+		if tooMany || tooOld {
+			if err := os.Remove(backup.path); err != nil {
+				os.Stderr.Write([]byte("[vlog] failed to remove rotated log file: " + err.Error() + "\n"))
+			}
+		}
+	}
+}
+
+type backupFile struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// backups returns the rotated files, newest first
+func (rf *rotatingFile) backups() ([]backupFile, error) {
+	dir, prefix, ext := rf.backupParts()
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []backupFile{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		timestamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+
+		rotatedAt, err := time.ParseInLocation(backupTimeFormat, timestamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backupFile{path: filepath.Join(dir, name), rotatedAt: rotatedAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotatedAt.After(backups[j].rotatedAt)
+	})
+
+	return backups, nil
+}
+
+// compressFile gzips a file, replacing it with path.gz
+func compressFile(path string, mode os.FileMode) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// Reopen closes and reopens the file at its path, for use after it has been moved by an external tool like logrotate
+func (rf *rotatingFile) Reopen() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file == nil {
+		return os.ErrClosed
+	}
+
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	return rf.open()
+}
+
+// reopenOnSIGHUP reopens the file each time the process receives SIGHUP, until the file is closed
+func (rf *rotatingFile) reopenOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-signals:
+				if err := rf.Reopen(); err != nil {
+					os.Stderr.Write([]byte("[vlog] failed to reopen log file: " + err.Error() + "\n"))
+				}
+			case <-rf.stopSignal:
+				return
+			}
+		}
+	}()
+}
+
+// Sync commits the file's contents to disk
+func (rf *rotatingFile) Sync() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	return rf.file.Sync()
+}
+
+// Close closes the file, after waiting for any rotated files to be compressed and removed
+func (rf *rotatingFile) Close() error {
+	rf.stopOnce.Do(func() {
+		close(rf.stopSignal)
+	})
+
+	rf.cleanup.Wait()
+
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	err := rf.file.Close()
+	rf.file = nil
+
+	return err
+}
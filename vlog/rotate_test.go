@@ -0,0 +1,139 @@
+package vlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	rf, err := openRotatingFile(path, 0, RotationPolicy{MaxBackups: 2, Compress: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rf.maxSize = 100
+
+	for i := 0; i < 10; i++ {
+		if _, err := rf.Write([]byte(strings.Repeat("x", 39) + "\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		// give each rotated file a distinct timestamp
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0644 || info.Size() != 80 {
+		t.Errorf("got mode %s and size %d", info.Mode().Perm(), info.Size())
+	}
+
+	backups, err := rf.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup.path, ".log.gz") {
+			t.Errorf("expected %s to be compressed", backup.path)
+			continue
+		}
+
+		file, _ := os.Open(backup.path)
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents, _ := io.ReadAll(gz)
+		file.Close()
+
+		if len(contents) != 80 {
+			t.Errorf("unexpected contents of %s: %q", backup.path, contents)
+		}
+	}
+}
+
+func TestRotateByTimeAndAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	// a rotated file from long ago
+	old := filepath.Join(dir, "app-"+time.Now().Add(-48*time.Hour).Format(backupTimeFormat)+".log")
+	if err := os.WriteFile(old, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := openRotatingFile(path, 0, RotationPolicy{Every: time.Hour, MaxAge: 24 * time.Hour}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rf.Write([]byte("first\n"))
+	rf.openedAt = rf.openedAt.Add(-time.Hour)
+	rf.Write([]byte("second\n"))
+
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := rf.backups()
+	if len(backups) != 1 {
+		t.Fatalf("expected only the new backup, got %v", backups)
+	}
+
+	if contents, _ := os.ReadFile(backups[0].path); string(contents) != "first\n" {
+		t.Errorf("unexpected backup contents %q", contents)
+	}
+
+	if contents, _ := os.ReadFile(path); string(contents) != "second\n" {
+		t.Errorf("unexpected contents %q", contents)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	log := Default(ToFile(path), ConsoleMirror(false))
+	defer log.Close()
+
+	log.Info("before")
+
+	// an external tool moves the file
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Info("after")
+
+	moved, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+
+	if !strings.Contains(string(moved), "before") || !strings.Contains(string(current), "after") || strings.Contains(string(current), "before") {
+		t.Errorf("unexpected contents %q and %q", moved, current)
+	}
+}
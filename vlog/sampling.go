@@ -0,0 +1,210 @@
+package vlog
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingPolicy limits how often the same message is logged. Within each interval, the first First logs with the
+// same level and message template are written, then every Thereafter-th one (none if Thereafter is zero). The template
+// is the message with any values that aren't strings left out, so pass changing values as non-string arguments or
+// fields to have them sampled together. Errors are never sampled
+type SamplingPolicy struct {
+	Interval   time.Duration `env:"LOG_SAMPLE_INTERVAL"`
+	First      int           `env:"LOG_SAMPLE_FIRST"`
+	Thereafter int           `env:"LOG_SAMPLE_THEREAFTER"`
+}
+
+// SuppressionStats counts the logs that weren't written because of sampling or deduplication
+type SuppressionStats struct {
+	Sampled      uint64 `json:"sampled"`
+	Deduplicated uint64 `json:"deduplicated"`
+}
+
+// sampler applies a SamplingPolicy, shared by every logger created from the same root
+type sampler struct {
+	policy SamplingPolicy
+
+	lock        sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+
+	suppressed atomic.Uint64
+}
+
+func newSampler(policy SamplingPolicy) *sampler {
+	if policy.Interval <= 0 || policy.First <= 0 {
+		return nil
+	}
+
+	return &sampler{policy: policy, counts: map[string]int{}}
+}
+
+// allow returns true if a log should be written
+func (s *sampler) allow(level int, template string) bool {
+	if s == nil || level <= 1 {
+		return true
+	}
+
+	key := logLevelStringFromVal(level) + ":" + template
+	now := time.Now()
+
+	s.lock.Lock()
+
+	// the counts are reset for every interval, which also stops them growing forever
+	if now.Sub(s.windowStart) >= s.policy.Interval {
+		s.windowStart = now
+		s.counts = map[string]int{}
+	}
+
+	s.counts[key]++
+	count := s.counts[key]
+
+	s.lock.Unlock()
+
+	if count <= s.policy.First {
+		return true
+	}
+
+	if s.policy.Thereafter > 0 && (count-s.policy.First)%s.policy.Thereafter == 0 {
+		return true
+	}
+
+	s.suppressed.Add(1)
+
+	return false
+}
+
+// messageTemplate returns the string arguments of a message, with a placeholder for anything else
+func messageTemplate(msgs []interface{}) string {
+	parts := make([]string, 0, len(msgs))
+
+	for _, m := range msgs {
+		switch elem := m.(type) {
+		case string:
+			parts = append(parts, elem)
+		case Field:
+			// fields aren't part of the message
+		default:
+			parts = append(parts, "%v")
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// deduplicator collapses consecutive identical logs, shared by every logger created from the same root
+type deduplicator struct {
+	window time.Duration
+
+	lock     sync.Mutex
+	last     *structuredLog // the last log written
+	repeated int            // the number of times it has been repeated since it was written
+
+	suppressed atomic.Uint64
+}
+
+func newDeduplicator(window time.Duration) *deduplicator {
+	if window <= 0 {
+		return nil
+	}
+
+	return &deduplicator{window: window}
+}
+
+// check returns whether a log should be written, along with a summary of the repeats of the previous log that
+// should be written before it, if there is one
+func (d *deduplicator) check(entry structuredLog) (bool, *structuredLog) {
+	if d == nil {
+		return true, nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.last != nil && sameLog(*d.last, entry) && entry.Timestamp.Sub(d.last.Timestamp) < d.window {
+		d.repeated++
+		d.suppressed.Add(1)
+
+		return false, nil
+	}
+
+	summary := d.summary()
+
+	d.last = &entry
+	d.repeated = 0
+
+	return true, summary
+}
+
+// flush returns a summary of the repeats of the last log if there are any
+func (d *deduplicator) flush() *structuredLog {
+	if d == nil {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	summary := d.summary()
+	d.repeated = 0
+
+	return summary
+}
+
+func (d *deduplicator) summary() *structuredLog {
+	if d.last == nil || d.repeated == 0 {
+		return nil
+	}
+
+	summary := *d.last
+	times := "times"
+	if d.repeated == 1 {
+		times = "time"
+	}
+
+	summary.LogMessage = summary.LogMessage + " (repeated " + strconv.Itoa(d.repeated) + " " + times + ")"
+	summary.Timestamp = time.Now()
+	summary.Fields = append(append([]Field{}, summary.Fields...), Field{Key: "repeated", value: d.repeated})
+
+	return &summary
+}
+
+// sameLog returns true if b repeats a, including its scope, caller and fields, so that a repeat is never
+// summarized with another log's details
+func sameLog(a, b structuredLog) bool {
+	if a.Level != b.Level || a.Logger != b.Logger || a.LogMessage != b.LogMessage || len(a.Fields) != len(b.Fields) {
+		return false
+	}
+
+	if (a.Caller == nil) != (b.Caller == nil) || (a.Caller != nil && *a.Caller != *b.Caller) {
+		return false
+	}
+
+	for i := range a.Fields {
+		if a.Fields[i].Key != b.Fields[i].Key || !reflect.DeepEqual(a.Fields[i].Value(), b.Fields[i].Value()) {
+			return false
+		}
+	}
+
+	return reflect.DeepEqual(a.ScopeMeta, b.ScopeMeta)
+}
+
+// Suppressed returns the number of logs that weren't written because of sampling or deduplication
+func (v *Logger) Suppressed() SuppressionStats {
+	stats := SuppressionStats{}
+
+	if v.sampler != nil {
+		stats.Sampled = v.sampler.suppressed.Load()
+	}
+
+	if v.dedup != nil {
+		stats.Deduplicated = v.dedup.suppressed.Load()
+	}
+
+	return stats
+}
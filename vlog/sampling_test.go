@@ -0,0 +1,96 @@
+package vlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), WithFormat(FormatText), ConsoleMirror(false), WithSampling(SamplingPolicy{Interval: time.Hour, First: 2, Thereafter: 3}))
+
+	for i := 0; i < 10; i++ {
+		log.Info("request from", i)
+		log.ErrorString("request failed")
+	}
+
+	// 1, 2, then 5 and 8
+	if count := strings.Count(buf.String(), "(I) request from"); count != 4 {
+		t.Errorf("expected 4 sampled info logs, got %d:\n%s", count, buf.String())
+	}
+
+	if count := strings.Count(buf.String(), "(E) request failed"); count != 10 {
+		t.Errorf("expected errors not to be sampled, got %d", count)
+	}
+
+	if stats := log.Suppressed(); stats.Sampled != 6 {
+		t.Errorf("expected 6 sampled logs, got %+v", stats)
+	}
+}
+
+func TestSamplingFromEnv(t *testing.T) {
+	t.Setenv("VLOG_LOG_SAMPLE_INTERVAL", "1h")
+	t.Setenv("VLOG_LOG_SAMPLE_FIRST", "1")
+
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), WithFormat(FormatText), ConsoleMirror(false))
+
+	log.Warn("disk full")
+	log.Warn("disk full")
+
+	if count := strings.Count(buf.String(), "\n"); count != 1 {
+		t.Errorf("expected 1 log, got %q", buf.String())
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), WithFormat(FormatText), ConsoleMirror(false), Dedupe(time.Hour))
+
+	for i := 0; i < 5; i++ {
+		log.Info("retrying")
+	}
+
+	log.Info("connected")
+	log.Info("connected")
+
+	if err := log.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "(I) retrying\n(I) retrying (repeated 4 times) repeated=4\n(I) connected\n(I) connected (repeated 1 time) repeated=1\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+
+	if stats := log.Suppressed(); stats.Deduplicated != 5 {
+		t.Errorf("expected 5 deduplicated logs, got %+v", stats)
+	}
+}
+
+func TestDedupeScopeAndFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), WithFormat(FormatText), ConsoleMirror(false), Dedupe(time.Hour))
+
+	type requestScope struct {
+		RequestID string
+	}
+
+	log.CreateScoped(requestScope{"a"}).Info("payment failed", String("user", "alice"), Int("status", 402))
+	log.CreateScoped(requestScope{"b"}).Info("payment failed", String("user", "bob"), Int("status", 500))
+	log.CreateScoped(requestScope{"b"}).Info("payment failed", String("user", "bob"), Int("status", 500))
+	log.CreateScoped(requestScope{"c"}).Info("payment failed", String("user", "bob"), Int("status", 500))
+
+	if err := log.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// logs that differ only in their scope or fields are each written
+	expected := "(I) payment failed user=alice status=402\n(I) payment failed user=bob status=500\n" +
+		"(I) payment failed (repeated 1 time) user=bob status=500 repeated=1\n(I) payment failed user=bob status=500\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,156 @@
+package vlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSinkBufferSize = 1024
+
+// sinkFlushTimeout limits how long Flush and Close wait for a sink, so that a stuck sink can't block shutdown
+const sinkFlushTimeout = 5 * time.Second
+
+// Sink is an additional destination for a logger's logs, with its own level, format and filter. Each sink is written
+// to from its own goroutine through a buffer, so a slow or broken sink drops its own logs rather than holding up the
+// application or the logger's other sinks
+type Sink struct {
+	Name       string           // identifies the sink in vlog's error messages
+	Writer     io.Writer        // where logs are written, such as a file from OpenFile or a *syslog.Writer
+	Level      string           // the sink's level, i.e. warn only writes warnings and errors. Defaults to the logger's level
+	Format     Format           // defaults to json
+	Filter     func(Entry) bool // if set, only logs for which it returns true are written
+	BufferSize int              // the number of logs buffered for the sink, 1024 by default
+}
+
+// Entry describes a log, for filtering logs sent to a Sink
+type Entry struct {
+	Message   string
+	Level     string
+	Timestamp time.Time
+	Logger    string
+	Scope     interface{}
+	App       interface{}
+	Fields    []Field
+}
+
+// sinkWriter writes logs to a Sink
+type sinkWriter struct {
+	sink   Sink
+	level  int
+	writer *logWriter
+
+	filterPanicked atomic.Bool // the filter's panics are reported once
+}
+
+func newSinkWriter(sink Sink) *sinkWriter {
+	level := 5
+	if sink.Level != "" {
+		level = logLevelValFromString(sink.Level)
+	}
+
+	if sink.Format == "" {
+		sink.Format = FormatJSON
+	}
+
+	if sink.BufferSize <= 0 {
+		sink.BufferSize = defaultSinkBufferSize
+	}
+
+	writer := &logWriter{
+		output:       &isolatedWriter{name: sink.Name, writer: sink.Writer},
+		ownsOutput:   true,
+		lock:         &sync.Mutex{},
+		async:        newRingBuffer(sink.BufferSize, OverflowDrop),
+		flushTimeout: sinkFlushTimeout,
+	}
+
+	go writer.writeAsync()
+
+	return &sinkWriter{sink: sink, level: level, writer: writer}
+}
+
+// accepts returns true if the log should be written to the sink. A filter that panics is treated as rejecting the log
+func (s *sinkWriter) accepts(entry structuredLog) (accepted bool) {
+	if entry.Level > s.level {
+		return false
+	}
+
+	if s.sink.Filter == nil {
+		return true
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if !s.filterPanicked.Swap(true) {
+				os.Stderr.Write([]byte(fmt.Sprintf("[vlog] filter for sink %s panicked, logs it panics for are not written: %v\n", s.sink.Name, r)))
+			}
+
+			accepted = false
+		}
+	}()
+
+	return s.sink.Filter(Entry{
+		Message:   entry.LogMessage,
+		Level:     logLevelStringFromVal(entry.Level),
+		Timestamp: entry.Timestamp,
+		Logger:    entry.Logger,
+		Scope:     entry.ScopeMeta,
+		App:       entry.AppMeta,
+		Fields:    entry.Fields,
+	})
+}
+
+// isolatedWriter keeps a sink's failures from affecting the rest of the logger. Errors and panics are reported once
+// when the sink starts failing and again once it recovers, rather than for every log
+type isolatedWriter struct {
+	name    string
+	writer  io.Writer
+	failing atomic.Bool
+}
+
+func (iw *isolatedWriter) Write(p []byte) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+
+		if err != nil {
+			if !iw.failing.Swap(true) {
+				os.Stderr.Write([]byte("[vlog] failed to write to sink " + iw.name + ", dropping its logs until it recovers: " + err.Error() + "\n"))
+			}
+
+			n, err = len(p), nil
+		} else if iw.failing.Swap(false) {
+			os.Stderr.Write([]byte("[vlog] sink " + iw.name + " recovered\n"))
+		}
+	}()
+
+	return iw.writer.Write(p)
+}
+
+// Sync syncs the sink's writer if it supports it
+func (iw *isolatedWriter) Sync() error {
+	if syncer, isSyncer := iw.writer.(interface{ Sync() error }); isSyncer {
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+// Close closes the sink's writer if it supports it
+func (iw *isolatedWriter) Close() error {
+	if closer, isCloser := iw.writer.(io.Closer); isCloser {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// OpenFile opens a log file for a Sink, with the same permissions and rotation as ToFile
+func OpenFile(path string, policy RotationPolicy) (io.WriteCloser, error) {
+	return openRotatingFile(path, defaultFileMode, policy, false)
+}
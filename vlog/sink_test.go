@@ -0,0 +1,143 @@
+package vlog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that is safe to read while a sink writes to it
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.buf.String()
+}
+
+type brokenWriter struct{}
+
+func (b brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("collector unavailable")
+}
+
+// stuckWriter never returns from Write until it is released
+type stuckWriter struct {
+	release chan struct{}
+}
+
+func (s stuckWriter) Write(p []byte) (int, error) {
+	<-s.release
+	return len(p), nil
+}
+
+func TestSinks(t *testing.T) {
+	out, errs, store := &syncBuffer{}, &syncBuffer{}, &syncBuffer{}
+	stuck := stuckWriter{release: make(chan struct{})}
+
+	log := Default(
+		Level(LogLevelDebug),
+		WithWriter(out),
+		ConsoleMirror(false),
+		WithSink(Sink{Name: "errors", Writer: errs, Level: LogLevelError, Format: FormatText}),
+		WithSink(Sink{Name: "store", Writer: store, Format: FormatLogfmt, Filter: func(e Entry) bool {
+			return e.Logger == "store"
+		}}),
+		WithSink(Sink{Name: "broken", Writer: brokenWriter{}}),
+		WithSink(Sink{Name: "stuck", Writer: stuck, BufferSize: 2}),
+		WithSink(Sink{Name: "panicky", Writer: out, Filter: func(e Entry) bool { panic("bad filter") }}),
+	)
+
+	// don't wait long for the stuck sink
+	log.sinks[3].writer.flushTimeout = 50 * time.Millisecond
+
+	log.Info("hello")
+	log.ErrorString("failed")
+	log.Named("store").Debug("cache miss")
+
+	if err := log.Flush(); err == nil || !strings.Contains(err.Error(), "sink stuck") {
+		t.Errorf("expected the stuck sink to time out, got %v", err)
+	}
+
+	if lines := strings.Count(out.String(), "\n"); lines != 3 {
+		t.Errorf("expected 3 lines in the output, got %q", out.String())
+	}
+
+	if errs.String() != "(E) failed\n" {
+		t.Errorf("unexpected errors sink output: %q", errs.String())
+	}
+
+	if !strings.Contains(store.String(), `level=debug logger=store log_message="(D) cache miss"`) || strings.Count(store.String(), "\n") != 1 {
+		t.Errorf("unexpected store sink output: %q", store.String())
+	}
+
+	// the stuck sink's buffer is full, so it drops logs
+	for i := 0; i < 3; i++ {
+		log.Info("dropped")
+	}
+
+	if log.Dropped() == 0 {
+		t.Error("expected the stuck sink to drop logs")
+	}
+
+	close(stuck.release)
+
+	if err := log.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStuckSinkClose(t *testing.T) {
+	stuck := stuckWriter{release: make(chan struct{})}
+	defer close(stuck.release)
+
+	log := Default(WithWriter(&syncBuffer{}), ConsoleMirror(false), WithSink(Sink{Name: "stuck", Writer: stuck}))
+
+	// don't wait long for the stuck sink
+	log.sinks[0].writer.flushTimeout = 50 * time.Millisecond
+
+	log.Info("hello")
+
+	closed := make(chan error)
+
+	go func() {
+		closed <- log.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Error("expected the stuck sink to time out")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on the stuck sink")
+	}
+
+	// logs after closing are discarded rather than blocking on the sink
+	logged := make(chan struct{})
+
+	go func() {
+		log.Info("after close")
+		close(logged)
+	}()
+
+	select {
+	case <-logged:
+	case <-time.After(time.Second):
+		t.Fatal("logging blocked on the stuck sink after Close")
+	}
+}
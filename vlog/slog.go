@@ -0,0 +1,238 @@
+package vlog
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// SlogLevelTrace is the slog level used for vlog's trace level, below slog.LevelDebug
+const SlogLevelTrace = slog.Level(-8)
+
+// slogHandler is a slog.Handler that logs records with a vlog Logger
+type slogHandler struct {
+	log   *Logger
+	group string
+}
+
+// NewSlogHandler returns a slog.Handler that logs with the provided Logger, so that libraries using log/slog share its
+// output, level, scope, AppMeta, PreLogHook and redaction. Record attributes are logged as fields (see Field), with the
+// keys of grouped attributes joined by a dot. slog levels below Debug are logged at the trace level
+func NewSlogHandler(log *Logger) slog.Handler {
+	return &slogHandler{log: log}
+}
+
+// Enabled implements slog.Handler
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.log.enabled(levelFromSlog(level))
+}
+
+// Handle implements slog.Handler
+func (h *slogHandler) Handle(_ context.Context, record slog.Record) error {
+	level := levelFromSlog(record.Level)
+	if !h.log.enabled(level) || !h.log.sampler.allow(level, record.Message) {
+		return nil
+	}
+
+	fields := make([]Field, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendSlogAttr(fields, h.group, attr)
+		return true
+	})
+
+	var msg string
+
+	switch level {
+	case 1:
+		msg = h.log.producer.ErrorString(record.Message)
+	case 2:
+		msg = h.log.producer.Warn(record.Message)
+	case 3:
+		msg = h.log.producer.Info(record.Message)
+	case 4:
+		msg = h.log.producer.Debug(record.Message)
+	default:
+		msg, _ = h.log.producer.Trace(record.Message)
+	}
+
+	var caller *Caller
+	if h.log.opts.Caller && record.PC != 0 {
+		caller = callerFromPC(record.PC)
+	}
+
+	h.log.logWithCaller(msg, h.log.scope, level, fields, caller)
+
+	return nil
+}
+
+// WithAttrs implements slog.Handler
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := []Field{}
+	for _, attr := range attrs {
+		fields = appendSlogAttr(fields, h.group, attr)
+	}
+
+	log := h.log.CreateScoped(h.log.scope)
+	log.fields = append(append([]Field{}, h.log.fields...), fields...)
+
+	return &slogHandler{log: log, group: h.group}
+}
+
+// WithGroup implements slog.Handler
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &slogHandler{log: h.log, group: joinKey(h.group, name)}
+}
+
+// appendSlogAttr converts an attribute to Fields, flattening groups
+func appendSlogAttr(fields []Field, group string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+
+	// empty attributes are ignored, as with the slog built-in handlers
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		if attr.Key != "" {
+			group = joinKey(group, attr.Key)
+		}
+
+		for _, a := range attr.Value.Group() {
+			fields = appendSlogAttr(fields, group, a)
+		}
+
+		return fields
+	case slog.KindTime:
+		return append(fields, Time(joinKey(group, attr.Key), attr.Value.Time()))
+	case slog.KindDuration:
+		return append(fields, Duration(joinKey(group, attr.Key), attr.Value.Duration()))
+	default:
+		// Any keeps primitives as they are and redacts everything else
+		return append(fields, Any(joinKey(group, attr.Key), attr.Value.Any()))
+	}
+}
+
+func joinKey(group, key string) string {
+	if group == "" {
+		return key
+	}
+
+	return group + "." + key
+}
+
+// FromSlog returns a Logger that sends everything it logs to a slog.Handler, so that a vektor server can share the
+// logging pipeline of code that uses log/slog. Messages are redacted and fields resolved as usual, and the logger's
+// name, scope and AppMeta are added as the "logger", "scope" and "app" attributes. The Logger's level defaults to
+// trace so that the handler decides what is logged
+func FromSlog(handler slog.Handler, opts ...OptionsModifier) *Logger {
+	opts = append([]OptionsModifier{Level(LogLevelTrace)}, opts...)
+	opts = append(opts, WithSlogHandler(handler))
+
+	return New(&slogProducer{}, opts...)
+}
+
+// logToSlog sends a log to the Options' SlogHandler rather than writing it to the output
+func (v *Logger) logToSlog(entry structuredLog) {
+	slogLevel := levelToSlog(entry.Level)
+
+	if !v.opts.SlogHandler.Enabled(context.Background(), slogLevel) {
+		return
+	}
+
+	var pc uintptr
+	if entry.Caller != nil {
+		pc = entry.Caller.pc
+	}
+
+	record := slog.NewRecord(entry.Timestamp, slogLevel, entry.LogMessage, pc)
+
+	if v.opts.AppMeta != nil {
+		record.AddAttrs(slog.Any("app", v.opts.AppMeta))
+	}
+
+	if entry.ScopeMeta != nil {
+		record.AddAttrs(slog.Any("scope", entry.ScopeMeta))
+	}
+
+	if entry.Logger != "" {
+		record.AddAttrs(slog.String("logger", entry.Logger))
+	}
+
+	for _, f := range entry.Fields {
+		record.AddAttrs(slog.Any(f.Key, f.value))
+	}
+
+	if err := v.opts.SlogHandler.Handle(context.Background(), record); err != nil {
+		os.Stderr.Write([]byte("[vlog] failed to write to slog handler: " + err.Error() + "\n"))
+	}
+}
+
+func levelFromSlog(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 1
+	case level >= slog.LevelWarn:
+		return 2
+	case level >= slog.LevelInfo:
+		return 3
+	case level >= slog.LevelDebug:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func levelToSlog(level int) slog.Level {
+	switch level {
+	case 1:
+		return slog.LevelError
+	case 2:
+		return slog.LevelWarn
+	case 3:
+		return slog.LevelInfo
+	case 4:
+		return slog.LevelDebug
+	default:
+		return SlogLevelTrace
+	}
+}
+
+// slogProducer produces messages without the level markers of the default producer, as slog handlers log the level
+type slogProducer struct{}
+
+// ErrorString prints a string as an error
+func (s *slogProducer) ErrorString(msgs ...interface{}) string {
+	return redactAndJoinInterfaces(msgs...)
+}
+
+// Error prints a string as an error
+func (s *slogProducer) Error(err error) string {
+	return err.Error()
+}
+
+// Warn prints a string as an warning
+func (s *slogProducer) Warn(msgs ...interface{}) string {
+	return redactAndJoinInterfaces(msgs...)
+}
+
+// Info prints a string as an info message
+func (s *slogProducer) Info(msgs ...interface{}) string {
+	return redactAndJoinInterfaces(msgs...)
+}
+
+// Debug prints a string as debug output
+func (s *slogProducer) Debug(msgs ...interface{}) string {
+	return redactAndJoinInterfaces(msgs...)
+}
+
+// Trace prints a function name and returns a function to be deferred, logging the completion of a function
+func (s *slogProducer) Trace(fnName string) (string, func() string) {
+	return fnName, func() string {
+		return fnName + " completed"
+	}
+}
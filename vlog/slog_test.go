@@ -0,0 +1,67 @@
+package vlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	hooked := 0
+
+	log := Default(Level(LogLevelInfo), WithWriter(buf), AppMeta("app"), PreLogHook(func([]byte) { hooked++ }))
+	logger := slog.New(NewSlogHandler(log.CreateScoped("scope")))
+
+	logger.Debug("not logged")
+	logger.With("user_id", 42).WithGroup("req").Warn("slow", "path", "/hello", slog.Group("db", "secret", unsafeStruct{Name: "Jeremy"}))
+
+	logged := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+		t.Fatal(err, buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"log_message":   "(W) slow",
+		"level":         float64(2),
+		"app":           "app",
+		"scope":         "scope",
+		"user_id":       float64(42),
+		"req.path":      "/hello",
+		"req.db.secret": "[redacted vlog.unsafeStruct]",
+	}
+
+	for key, val := range expected {
+		if logged[key] != val {
+			t.Errorf("expected %s to be %v, got %v", key, val, logged[key])
+		}
+	}
+
+	if hooked != 1 {
+		t.Errorf("expected the hook to run once, ran %d times", hooked)
+	}
+}
+
+func TestFromSlog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+
+	log := FromSlog(handler, AppMeta("app")).Named("store")
+
+	log.Debug("not logged")
+	log.With("user", unsafeStruct{Name: "Jeremy"}).Warn("cache miss", safeStruct{Name: "Anthony"}, Int("attempt", 2))
+
+	out := buf.String()
+
+	for _, expected := range []string{`level=WARN`, `msg="cache miss Anthony"`, `app=app`, `logger=store`, `user="[redacted vlog.unsafeStruct]"`, `attempt=2`} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %s in %q", expected, out)
+		}
+	}
+
+	if strings.Contains(out, "not logged") {
+		t.Errorf("expected the handler's level to be used: %q", out)
+	}
+}
@@ -8,4 +8,7 @@ type structuredLog struct {
 	Level      int         `json:"level"`
 	AppMeta    interface{} `json:"app,omitempty"`
 	ScopeMeta  interface{} `json:"scope,omitempty"`
+	Logger     string      `json:"logger,omitempty"`
+	Caller     *Caller     `json:"caller,omitempty"`
+	Fields     []Field     `json:"-"`
 }
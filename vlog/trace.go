@@ -0,0 +1,213 @@
+package vlog
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SpanScope can be implemented by a logger's scope to set the parent of the spans traced with it, such as a
+// request ID, so that the spans of a request can be grouped together
+type SpanScope interface {
+	SpanID() string
+}
+
+// SpanStats aggregates the durations of the spans with the same name, when the TraceSummary option is used
+type SpanStats struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	Total time.Duration `json:"total"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+}
+
+// Mean returns the average duration of the spans
+func (s SpanStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	return s.Total / time.Duration(s.Count)
+}
+
+// traceSummary aggregates spans by name, shared by every logger created from the same root
+type traceSummary struct {
+	lock  sync.Mutex
+	stats map[string]*SpanStats
+}
+
+func newTraceSummary(enabled bool) *traceSummary {
+	if !enabled {
+		return nil
+	}
+
+	return &traceSummary{stats: map[string]*SpanStats{}}
+}
+
+func (ts *traceSummary) add(name string, elapsed time.Duration) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	stats, exists := ts.stats[name]
+	if !exists {
+		stats = &SpanStats{Name: name, Min: elapsed}
+		ts.stats[name] = stats
+	}
+
+	stats.Count++
+	stats.Total += elapsed
+
+	if elapsed < stats.Min {
+		stats.Min = elapsed
+	}
+
+	if elapsed > stats.Max {
+		stats.Max = elapsed
+	}
+}
+
+// snapshot returns the stats sorted by total duration, longest first, optionally resetting them
+func (ts *traceSummary) snapshot(reset bool) []SpanStats {
+	if ts == nil {
+		return nil
+	}
+
+	ts.lock.Lock()
+
+	all := make([]SpanStats, 0, len(ts.stats))
+	for _, stats := range ts.stats {
+		all = append(all, *stats)
+	}
+
+	if reset {
+		ts.stats = map[string]*SpanStats{}
+	}
+
+	ts.lock.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Total == all[j].Total {
+			return all[i].Name < all[j].Name
+		}
+
+		return all[i].Total > all[j].Total
+	})
+
+	return all
+}
+
+// Trace logs a function name and returns a function to be deferred, logging the completion of the function along
+// with how long it took. See Span for the fields that are included
+func (v *Logger) Trace(fnName string) func() {
+	_, end := v.startSpan(fnName, v.caller(1))
+
+	return func() {
+		end(v.caller(1))
+	}
+}
+
+// Span starts a span like Trace, and also returns a logger whose traces are nested within it. Trace logs include the
+// span's ID as span_id and the ID of the span it's nested in as parent_span_id, which is the span of the logger or
+// the SpanID of its scope, and the completion log includes the span's duration as duration_ms
+func (v *Logger) Span(name string) (*Logger, func()) {
+	spanLog, end := v.startSpan(name, v.caller(1))
+
+	return spanLog, func() {
+		end(v.caller(1))
+	}
+}
+
+func (v *Logger) startSpan(name string, caller *Caller) (*Logger, func(*Caller)) {
+	if !v.enabled(5) || (v.traces == nil && !v.sampler.allow(5, name)) {
+		return v, func(*Caller) {}
+	}
+
+	spanLog := v.CreateScoped(v.scope)
+	spanLog.span = newSpanID()
+
+	fields := []Field{String("span_id", spanLog.span)}
+	if parent := v.parentSpan(); parent != "" {
+		fields = append(fields, String("parent_span_id", parent))
+	}
+
+	msg, traceFunc := v.producer.Trace(name)
+
+	// with a threshold it isn't known whether the span should be logged until it completes
+	if v.traces == nil && v.opts.TraceThreshold == 0 {
+		v.logWithCaller(msg, v.scope, 5, fields, caller)
+	}
+
+	start := time.Now()
+
+	return spanLog, func(caller *Caller) {
+		elapsed := time.Since(start)
+
+		if v.traces != nil {
+			v.traces.add(name, elapsed)
+			return
+		}
+
+		if elapsed < v.opts.TraceThreshold {
+			return
+		}
+
+		fields := append(fields, Float64("duration_ms", durationMillis(elapsed)))
+
+		v.logWithCaller(traceFunc(), v.scope, 5, fields, caller)
+	}
+}
+
+// parentSpan returns the ID of the span that spans started from the logger are nested in
+func (v *Logger) parentSpan() string {
+	if v.span != "" {
+		return v.span
+	}
+
+	if spanScope, isSpanScope := v.scope.(SpanScope); isSpanScope {
+		return spanScope.SpanID()
+	}
+
+	return ""
+}
+
+// caller returns the caller skip frames above the function calling it if the logger includes callers
+func (v *Logger) caller(skip int) *Caller {
+	if !v.opts.Caller {
+		return nil
+	}
+
+	return callerAt(skip + 1)
+}
+
+// TraceStats returns the durations of the spans traced since the summary was last written, when the TraceSummary
+// option is used
+func (v *Logger) TraceStats() []SpanStats {
+	return v.traces.snapshot(false)
+}
+
+// writeTraceSummary logs the aggregated spans, longest first, and resets them
+func (v *Logger) writeTraceSummary() {
+	for _, stats := range v.traces.snapshot(true) {
+		fields := []Field{
+			Int("count", stats.Count),
+			Float64("total_ms", durationMillis(stats.Total)),
+			Float64("mean_ms", durationMillis(stats.Mean())),
+			Float64("min_ms", durationMillis(stats.Min)),
+			Float64("max_ms", durationMillis(stats.Max)),
+		}
+
+		msg, _ := v.producer.Trace(stats.Name)
+
+		v.logWithCaller(msg+" summary", v.scope, 5, fields, nil)
+	}
+}
+
+func newSpanID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,140 @@
+package vlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type traceLine struct {
+	Message  string  `json:"log_message"`
+	SpanID   string  `json:"span_id"`
+	ParentID string  `json:"parent_span_id"`
+	Duration float64 `json:"duration_ms"`
+	Count    int     `json:"count"`
+	Caller   *Caller `json:"caller"`
+}
+
+func traceLines(t *testing.T, buf *bytes.Buffer) []traceLine {
+	lines := []traceLine{}
+
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		line := traceLine{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err, scanner.Text())
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+type requestScope struct {
+	RequestID string `json:"request_id"`
+}
+
+func (r requestScope) SpanID() string {
+	return r.RequestID
+}
+
+func TestSpans(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), ConsoleMirror(false), Level(LogLevelTrace), WithCaller()).CreateScoped(requestScope{"req-1"})
+
+	handlerLog, end := log.Span("handler")
+	done := handlerLog.Trace("query")
+	time.Sleep(5 * time.Millisecond)
+	done()
+	end()
+
+	lines := traceLines(t, buf)
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d", len(lines))
+	}
+
+	handlerStart, queryStart, queryEnd, handlerEnd := lines[0], lines[1], lines[2], lines[3]
+
+	if handlerStart.Message != "(T) handler" || queryEnd.Message != "(T) query completed" {
+		t.Errorf("unexpected messages %q, %q", handlerStart.Message, queryEnd.Message)
+	}
+
+	if handlerStart.SpanID == "" || handlerStart.SpanID != handlerEnd.SpanID || handlerStart.ParentID != "req-1" {
+		t.Errorf("unexpected handler span %+v, %+v", handlerStart, handlerEnd)
+	}
+
+	if queryStart.SpanID != queryEnd.SpanID || queryStart.SpanID == handlerStart.SpanID || queryStart.ParentID != handlerStart.SpanID {
+		t.Errorf("expected query to be nested in handler, got %+v", queryStart)
+	}
+
+	if queryEnd.Duration < 5 || handlerEnd.Duration < queryEnd.Duration || queryStart.Duration != 0 {
+		t.Errorf("unexpected durations %f, %f", queryEnd.Duration, handlerEnd.Duration)
+	}
+
+	for _, line := range lines {
+		if line.Caller == nil || line.Caller.File != "vlog/trace_test.go" {
+			t.Errorf("unexpected caller %+v", line.Caller)
+		}
+	}
+}
+
+func TestTraceThreshold(t *testing.T) {
+	t.Setenv("VLOG_LOG_TRACE_THRESHOLD", "10ms")
+
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), ConsoleMirror(false), Level(LogLevelTrace))
+
+	log.Trace("fast")()
+
+	done := log.Trace("slow")
+	time.Sleep(10 * time.Millisecond)
+	done()
+
+	lines := traceLines(t, buf)
+	if len(lines) != 1 || lines[0].Message != "(T) slow completed" || lines[0].Duration < 10 {
+		t.Errorf("expected only the slow span's completion, got %+v", lines)
+	}
+}
+
+func TestTraceSummary(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := Default(WithWriter(buf), ConsoleMirror(false), Level(LogLevelTrace), TraceSummary())
+
+	for i := 0; i < 3; i++ {
+		log.Trace("query")()
+	}
+
+	done := log.Trace("handler")
+	time.Sleep(5 * time.Millisecond)
+	done()
+
+	if buf.Len() != 0 {
+		t.Errorf("expected spans to be aggregated, got %q", buf.String())
+	}
+
+	stats := log.TraceStats()
+	if len(stats) != 2 || stats[0].Name != "handler" || stats[1].Count != 3 || stats[1].Min > stats[1].Max {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if err := log.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := traceLines(t, buf)
+	if len(lines) != 2 || lines[0].Message != "(T) handler summary" || lines[1].Count != 3 {
+		t.Errorf("unexpected summary %+v", lines)
+	}
+
+	// the summary is reset once it's written
+	if err := log.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 || len(log.TraceStats()) != 0 {
+		t.Errorf("expected the summary to be reset, got %q", buf.String())
+	}
+}
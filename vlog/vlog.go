@@ -1,10 +1,9 @@
 package vlog
 
 import (
-	"encoding/json"
+	"fmt"
 	"io"
 	"os"
-	"sync"
 	"time"
 )
 
@@ -24,8 +23,15 @@ type Logger struct {
 	producer Producer
 	scope    interface{}
 	opts     *Options
-	output   io.Writer
-	lock     *sync.Mutex
+	name     string
+	levels   *levels // shared with scoped and named loggers so that level changes apply to all of them
+	fields   []Field
+	writer   *logWriter // shared with scoped and named loggers
+	sinks    []*sinkWriter
+	sampler  *sampler
+	dedup    *deduplicator
+	traces   *traceSummary
+	span     string // the span that spans started from the logger are nested in
 }
 
 // SafeStringer allows a struct to produse a "safe" string representation for logging
@@ -49,15 +55,15 @@ func New(producer Producer, opts ...OptionsModifier) *Logger {
 		producer: producer,
 		scope:    nil,
 		opts:     options,
-		lock:     &sync.Mutex{},
+		levels:   newLevels(options.Level),
+		writer:   newLogWriter(options),
+		sampler:  newSampler(options.Sampling),
+		dedup:    newDeduplicator(options.DedupWindow),
+		traces:   newTraceSummary(options.TraceSummary),
 	}
 
-	output, err := outputForOptions(options)
-	if err != nil {
-		v.output = os.Stdout
-		os.Stderr.Write([]byte("[vlog] failed to set output: " + err.Error() + "\n"))
-	} else {
-		v.output = output
+	for _, sink := range options.Sinks {
+		v.sinks = append(v.sinks, newSinkWriter(sink))
 	}
 
 	return v
@@ -69,8 +75,15 @@ func (v *Logger) CreateScoped(scope interface{}) *Logger {
 		producer: v.producer,
 		scope:    scope,
 		opts:     v.opts,
-		output:   v.output,
-		lock:     v.lock,
+		name:     v.name,
+		levels:   v.levels,
+		fields:   v.fields,
+		writer:   v.writer,
+		sinks:    v.sinks,
+		sampler:  v.sampler,
+		dedup:    v.dedup,
+		traces:   v.traces,
+		span:     v.span,
 	}
 
 	return sl
@@ -78,69 +91,98 @@ func (v *Logger) CreateScoped(scope interface{}) *Logger {
 
 // ErrorString logs a string as an error
 func (v *Logger) ErrorString(msgs ...interface{}) {
+	if !v.enabled(1) {
+		return
+	}
+
+	msgs, fields := splitFields(msgs)
 	msg := v.producer.ErrorString(msgs...)
 
-	v.log(msg, v.scope, 1)
+	v.log(msg, v.scope, 1, fields)
 }
 
 // Error logs an error as an error
 func (v *Logger) Error(err error) {
+	if !v.enabled(1) {
+		return
+	}
+
 	msg := v.producer.Error(err)
 
-	v.log(msg, v.scope, 1)
+	v.log(msg, v.scope, 1, errorFields(err))
 }
 
 // Warn logs a string as an warning
 func (v *Logger) Warn(msgs ...interface{}) {
+	if !v.enabled(2) || !v.sample(2, msgs) {
+		return
+	}
+
+	msgs, fields := splitFields(msgs)
 	msg := v.producer.Warn(msgs...)
 
-	v.log(msg, v.scope, 2)
+	v.log(msg, v.scope, 2, fields)
 }
 
 // Info logs a string as an info message
 func (v *Logger) Info(msgs ...interface{}) {
+	if !v.enabled(3) || !v.sample(3, msgs) {
+		return
+	}
+
+	msgs, fields := splitFields(msgs)
 	msg := v.producer.Info(msgs...)
 
-	v.log(msg, v.scope, 3)
+	v.log(msg, v.scope, 3, fields)
 }
 
 // Debug logs a string as debug output
 func (v *Logger) Debug(msgs ...interface{}) {
+	if !v.enabled(4) || !v.sample(4, msgs) {
+		return
+	}
+
+	msgs, fields := splitFields(msgs)
 	msg := v.producer.Debug(msgs...)
 
-	v.log(msg, v.scope, 4)
+	v.log(msg, v.scope, 4, fields)
 }
 
-// Trace logs a function name and returns a function to be deferred, logging the completion of a function
-func (v *Logger) Trace(fnName string) func() {
-	msg, traceFunc := v.producer.Trace(fnName)
+// enabled returns true if messages at the level should be logged, so that they're only formatted if they will be
+func (v *Logger) enabled(level int) bool {
+	return v.levels.enabled(v.name, level)
+}
 
-	v.log(msg, v.scope, 5)
+// sample returns true if a message isn't suppressed by the sampling policy
+func (v *Logger) sample(level int, msgs []interface{}) bool {
+	if v.sampler == nil {
+		return true
+	}
 
-	return func() {
-		msg := traceFunc()
+	return v.sampler.allow(level, messageTemplate(msgs))
+}
 
-		v.log(msg, v.scope, 5)
+func (v *Logger) log(message string, scope interface{}, level int, fields []Field) {
+	var caller *Caller
+	if v.opts.Caller {
+		// skip this function and the log method that called it
+		caller = callerAt(2)
 	}
+
+	v.logWithCaller(message, scope, level, fields, caller)
 }
 
-func (v *Logger) log(message string, scope interface{}, level int) {
-	if level > v.opts.Level {
-		return
+func (v *Logger) logWithCaller(message string, scope interface{}, level int, fields []Field, caller *Caller) {
+	if len(v.fields) > 0 {
+		fields = append(append([]Field{}, v.fields...), fields...)
 	}
 
-	if v.opts.LogPrefix != "" {
-		message = v.opts.LogPrefix + " " + message
+	if len(fields) > 0 {
+		fields = resolveFields(fields)
 	}
 
-	// send the raw message to the console
-	if v.output != os.Stdout {
-		// acquire a lock as the output may be a file
-		v.lock.Lock()
-		defer v.lock.Unlock()
-
-		// throwing away the error here since there's nothing much we can do
-		os.Stdout.Write(append([]byte(message), []byte("\n")...))
+	if v.opts.LogPrefix != "" {
+		message = v.opts.LogPrefix + " " + message
 	}
 
 	structured := structuredLog{
@@ -149,42 +191,131 @@ func (v *Logger) log(message string, scope interface{}, level int) {
 		Level:      level,
 		AppMeta:    v.opts.AppMeta,
 		ScopeMeta:  scope,
+		Logger:     v.name,
+		Caller:     caller,
+		Fields:     fields,
+	}
+
+	write, summary := v.dedup.check(structured)
+	if summary != nil {
+		v.write(*summary)
+	}
+
+	if write {
+		v.write(structured)
+	}
+}
+
+// write sends a log to the sinks and the output
+func (v *Logger) write(structured structuredLog) {
+	for _, sink := range v.sinks {
+		if sink.accepts(structured) {
+			sink.writer.write(logLine{out: v.opts.encode(sink.sink.Format, structured)})
+		}
+	}
+
+	if v.opts.SlogHandler != nil {
+		v.logToSlog(structured)
+		return
 	}
 
-	structuredJSON, err := json.Marshal(structured)
-	if err != nil {
-		os.Stderr.Write([]byte("[vlog] failed to marshal structured log"))
+	var structuredJSON []byte
+	if v.opts.Format == FormatJSON || v.opts.PreLogHook != nil {
+		structuredJSON = v.opts.encodeJSON(structured)
 	}
 
 	if v.opts.PreLogHook != nil {
-		v.opts.PreLogHook(structuredJSON)
+		v.opts.PreLogHook(structuredJSON[:len(structuredJSON)-1])
 	}
 
-	structuredOut := append(structuredJSON, []byte("\n")...)
+	out := structuredJSON
+	if v.opts.Format != FormatJSON {
+		out = v.opts.encode(v.opts.Format, structured)
+	}
 
-	_, err = v.output.Write(structuredOut)
-	if err != nil {
-		os.Stderr.Write([]byte("[vlog] failed to write to configured output: " + err.Error() + "\n"))
+	line := logLine{out: out}
+	if v.writer.mirror {
+		line.console = v.opts.encode(v.opts.ConsoleFormat, structured)
 	}
+
+	v.writer.write(line)
 }
 
-func outputForOptions(opts *Options) (io.Writer, error) {
-	var output io.Writer
+// Flush writes the trace summary if the TraceSummary option is used, waits until every log has been written, when
+// the logger is async, and syncs the output if it's a file opened with ToFile. It applies to every logger scoped or named from the logger
+func (v *Logger) Flush() error {
+	v.writeTraceSummary()
+
+	if summary := v.dedup.flush(); summary != nil {
+		v.write(*summary)
+	}
+
+	err := v.writer.flush()
+
+	for _, sink := range v.sinks {
+		if sinkErr := sink.writer.flush(); sinkErr != nil && err == nil {
+			err = fmt.Errorf("sink %s: %w", sink.sink.Name, sinkErr)
+		}
+	}
+
+	return err
+}
 
+// Close flushes the logger and closes its output if it's a file opened with ToFile, along with any sinks' writers
+// that are an io.Closer. Anything logged afterwards is
+// written synchronously (and discarded if the file was closed). Close should be called before exiting when the logger
+// is async, so that buffered logs aren't lost
+func (v *Logger) Close() error {
+	v.writeTraceSummary()
+
+	if summary := v.dedup.flush(); summary != nil {
+		v.write(*summary)
+	}
+
+	err := v.writer.close()
+
+	for _, sink := range v.sinks {
+		if sinkErr := sink.writer.close(); sinkErr != nil && err == nil {
+			err = fmt.Errorf("sink %s: %w", sink.sink.Name, sinkErr)
+		}
+	}
+
+	return err
+}
+
+// Reopen closes and reopens the file opened with ToFile, so that logging continues to a new file after an external
+// tool such as logrotate has moved it. It does nothing for other outputs
+func (v *Logger) Reopen() error {
+	if file, isRotating := v.writer.output.(*rotatingFile); isRotating {
+		return file.Reopen()
+	}
+
+	return nil
+}
+
+// Dropped returns the number of logs that an async logger or its sinks have dropped because a buffer was full
+func (v *Logger) Dropped() uint64 {
+	var dropped uint64
+
+	if v.writer.async != nil {
+		dropped = v.writer.async.dropped.Load()
+	}
+
+	for _, sink := range v.sinks {
+		dropped += sink.writer.async.dropped.Load()
+	}
+
+	return dropped
+}
+
+func outputForOptions(opts *Options) (io.Writer, error) {
 	if opts.OutputWriter != nil {
 		return opts.OutputWriter, nil
 	}
 
 	if opts.Filepath != "" {
-		file, err := os.OpenFile(opts.Filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.ModePerm)
-		if err != nil {
-			return nil, err
-		}
-
-		output = file
-	} else {
-		output = os.Stdout
+		return openRotatingFile(opts.Filepath, opts.FileMode, opts.Rotation, opts.ReopenOnSIGHUP)
 	}
 
-	return output, nil
+	return os.Stdout, nil
 }
@@ -0,0 +1,334 @@
+package vlog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what happens when an async logger's buffer is full
+type OverflowPolicy string
+
+// OverflowDrop and OverflowBlock are the available overflow policies
+const (
+	OverflowDrop  OverflowPolicy = "drop"  // the oldest buffered log is dropped to make room (the default)
+	OverflowBlock OverflowPolicy = "block" // logging blocks until there is room
+)
+
+// stdoutLock serializes writes to stdout from every logger
+var stdoutLock sync.Mutex
+
+// errFlushTimeout is returned when buffered logs aren't written within a writer's flush timeout
+var errFlushTimeout = errors.New("timed out waiting for buffered logs to be written")
+
+// logLine is an encoded log waiting to be written
+type logLine struct {
+	out     []byte
+	console []byte // written to stdout if the console mirror is enabled
+}
+
+// logWriter writes encoded logs to a logger's output, shared by every logger created from it
+type logWriter struct {
+	output     io.Writer
+	ownsOutput bool // the output was opened by the logger, so it is closed by Close
+	mirror     bool // also write logs to stdout in the console format
+	lock       *sync.Mutex
+
+	async        *ringBuffer
+	flushTimeout time.Duration // how long to wait for buffered logs to be written, forever if zero
+	closed       atomic.Bool
+	stuck        atomic.Bool // set if the output was still writing when the writer was closed
+	closeOnce    sync.Once
+}
+
+func newLogWriter(opts *Options) *logWriter {
+	w := &logWriter{lock: &sync.Mutex{}}
+
+	output, err := outputForOptions(opts)
+	if err != nil {
+		w.output = os.Stdout
+		os.Stderr.Write([]byte("[vlog] failed to set output: " + err.Error() + "\n"))
+	} else {
+		w.output = output
+		w.ownsOutput = opts.OutputWriter == nil && opts.Filepath != ""
+	}
+
+	if w.output == os.Stdout {
+		w.lock = &stdoutLock
+	}
+
+	if opts.ConsoleMirror != nil {
+		w.mirror = *opts.ConsoleMirror
+	} else {
+		w.mirror = w.output != os.Stdout
+	}
+
+	if opts.BufferSize > 0 && opts.SlogHandler == nil {
+		w.async = newRingBuffer(opts.BufferSize, opts.Overflow)
+		go w.writeAsync()
+	}
+
+	return w
+}
+
+// write writes a log, or buffers it to be written if the logger is async
+func (w *logWriter) write(line logLine) {
+	if w.stuck.Load() {
+		return
+	}
+
+	if w.async != nil && !w.closed.Load() {
+		if w.async.push(line) {
+			return
+		}
+	}
+
+	w.writeLine(line)
+}
+
+func (w *logWriter) writeLine(line logLine) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.mirror {
+		if w.output != os.Stdout {
+			stdoutLock.Lock()
+			defer stdoutLock.Unlock()
+		}
+
+		// throwing away the error here since there's nothing much we can do
+		os.Stdout.Write(line.console)
+	}
+
+	if _, err := w.output.Write(line.out); err != nil {
+		os.Stderr.Write([]byte("[vlog] failed to write to configured output: " + err.Error() + "\n"))
+	}
+}
+
+// writeAsync writes buffered logs until the buffer is closed
+func (w *logWriter) writeAsync() {
+	for {
+		lines, ok := w.async.take()
+		if !ok {
+			return
+		}
+
+		for _, line := range lines {
+			w.writeLine(line)
+		}
+
+		w.async.done()
+	}
+}
+
+// flush waits until every buffered log has been written, and syncs the output if it's a file
+func (w *logWriter) flush() error {
+	if err := w.waitAsync(); err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if syncer, isSyncer := w.output.(interface{ Sync() error }); isSyncer && w.ownsOutput {
+		return syncer.Sync()
+	}
+
+	return nil
+}
+
+// waitAsync waits until every buffered log has been written, or the writer's flush timeout passes
+func (w *logWriter) waitAsync() error {
+	if w.async == nil {
+		return nil
+	}
+
+	if w.flushTimeout == 0 {
+		w.async.wait()
+		return nil
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		w.async.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(w.flushTimeout):
+		return errFlushTimeout
+	}
+}
+
+// close flushes the writer, stops its async writer, and closes the output if it was opened by the logger.
+// Logs written after the writer is closed are written synchronously, and discarded if the output was closed.
+// If the output is stuck in a write past the flush timeout, it is closed without waiting for the write (which
+// holds the lock), and later logs are discarded rather than blocking on it
+func (w *logWriter) close() error {
+	var err error
+
+	w.closeOnce.Do(func() {
+		err = w.flush()
+
+		w.closed.Store(true)
+
+		if w.async != nil {
+			w.async.close()
+
+			// wait for anything logged while closing, unless the output is already known to be stuck
+			if !errors.Is(err, errFlushTimeout) {
+				if waitErr := w.waitAsync(); waitErr != nil {
+					err = waitErr
+				}
+			}
+		}
+
+		if errors.Is(err, errFlushTimeout) {
+			w.stuck.Store(true)
+
+			// closing the output may also unblock the stuck write
+			if closeErr := w.closeOutput(); closeErr != nil {
+				err = closeErr
+			}
+
+			return
+		}
+
+		w.lock.Lock()
+		defer w.lock.Unlock()
+
+		if closeErr := w.closeOutput(); closeErr != nil {
+			err = closeErr
+		}
+
+		if w.ownsOutput {
+			w.output = io.Discard
+		}
+	})
+
+	return err
+}
+
+// closeOutput closes the output if it was opened by the logger
+func (w *logWriter) closeOutput() error {
+	if closer, isCloser := w.output.(io.Closer); isCloser && w.ownsOutput {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// ringBuffer is a bounded queue of logs waiting to be written
+type ringBuffer struct {
+	lock     sync.Mutex
+	cond     *sync.Cond // signalled whenever lines are pushed or taken, or the buffer is closed
+	lines    []logLine
+	head     int
+	count    int
+	writing  bool // lines have been taken but not yet written
+	closed   bool
+	overflow OverflowPolicy
+	dropped  atomic.Uint64
+}
+
+func newRingBuffer(size int, overflow OverflowPolicy) *ringBuffer {
+	rb := &ringBuffer{
+		lines:    make([]logLine, size),
+		overflow: overflow,
+	}
+
+	rb.cond = sync.NewCond(&rb.lock)
+
+	return rb
+}
+
+// push adds a line to the buffer, dropping the oldest line or blocking if it is full depending on the overflow
+// policy. It returns false if the buffer has been closed
+func (rb *ringBuffer) push(line logLine) bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	for rb.count == len(rb.lines) && rb.overflow == OverflowBlock && !rb.closed {
+		rb.cond.Wait()
+	}
+
+	if rb.closed {
+		return false
+	}
+
+	if rb.count == len(rb.lines) {
+		rb.lines[rb.head] = logLine{}
+		rb.head = (rb.head + 1) % len(rb.lines)
+		rb.count--
+		rb.dropped.Add(1)
+	}
+
+	rb.lines[(rb.head+rb.count)%len(rb.lines)] = line
+	rb.count++
+
+	rb.cond.Broadcast()
+
+	return true
+}
+
+// take waits for lines to be pushed and removes them all from the buffer. It returns false once the buffer has been
+// closed and emptied
+func (rb *ringBuffer) take() ([]logLine, bool) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	for rb.count == 0 && !rb.closed {
+		rb.cond.Wait()
+	}
+
+	if rb.count == 0 {
+		return nil, false
+	}
+
+	lines := make([]logLine, 0, rb.count)
+
+	for ; rb.count > 0; rb.count-- {
+		lines = append(lines, rb.lines[rb.head])
+		rb.lines[rb.head] = logLine{}
+		rb.head = (rb.head + 1) % len(rb.lines)
+	}
+
+	rb.writing = true
+	rb.cond.Broadcast()
+
+	return lines, true
+}
+
+// done marks the lines last taken as written
+func (rb *ringBuffer) done() {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	rb.writing = false
+	rb.cond.Broadcast()
+}
+
+// wait blocks until the buffer is empty and every line taken from it has been written
+func (rb *ringBuffer) wait() {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	for rb.count > 0 || rb.writing {
+		rb.cond.Wait()
+	}
+}
+
+// close stops the buffer accepting lines. Lines already in it are still written
+func (rb *ringBuffer) close() {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	rb.closed = true
+	rb.cond.Broadcast()
+}
@@ -0,0 +1,114 @@
+package vlog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowWriter is deliberately not safe for concurrent use, so that the race detector catches unserialized writes
+type slowWriter struct {
+	buf   bytes.Buffer
+	delay time.Duration
+}
+
+func (s *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.buf.Write(p)
+}
+
+func logConcurrently(log *Logger, goroutines, lines int) {
+	wg := sync.WaitGroup{}
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			scoped := log.CreateScoped(g)
+			for i := 0; i < lines; i++ {
+				scoped.Info(fmt.Sprintf("line %d-%d", g, i))
+			}
+		}(g)
+	}
+
+	wg.Wait()
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	out := &slowWriter{}
+	log := Default(WithWriter(out), ConsoleMirror(false))
+
+	logConcurrently(log, 8, 50)
+
+	if lines := strings.Count(out.buf.String(), "\n"); lines != 400 {
+		t.Errorf("expected 400 lines, got %d", lines)
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	out := &slowWriter{delay: 10 * time.Microsecond}
+	log := Default(WithWriter(out), ConsoleMirror(false), Async(16, OverflowBlock))
+
+	logConcurrently(log, 8, 50)
+
+	if err := log.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(out.buf.String(), "\n"); lines != 400 || log.Dropped() != 0 {
+		t.Errorf("expected 400 lines and none dropped, got %d and %d", lines, log.Dropped())
+	}
+}
+
+func TestAsyncDrop(t *testing.T) {
+	out := &slowWriter{delay: time.Millisecond}
+	log := Default(WithWriter(out), ConsoleMirror(false), Async(4, OverflowDrop))
+
+	logConcurrently(log, 4, 25)
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Count(out.buf.String(), "\n")
+
+	if log.Dropped() == 0 || uint64(lines)+log.Dropped() != 100 {
+		t.Errorf("expected some of 100 lines to be dropped, got %d written and %d dropped", lines, log.Dropped())
+	}
+
+	// logs after closing are written synchronously
+	log.Info("after close")
+
+	if !strings.Contains(out.buf.String(), "after close") {
+		t.Error("expected the log after closing to be written")
+	}
+}
+
+func TestCloseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vlog.log")
+
+	log := Default(ToFile(path), ConsoleMirror(false), Async(8, OverflowBlock))
+	log.Info("hello")
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log.Info("discarded")
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(contents), "hello") || strings.Contains(string(contents), "discarded") {
+		t.Errorf("unexpected file contents: %s", contents)
+	}
+}